@@ -0,0 +1,82 @@
+// Command reencrypt re-wraps history data keys with the current master key
+// and brings every user's stored history in line with their encryption
+// setting. Run it after changing HISTORY_ENCRYPTION_KEY, before removing
+// the old key from HISTORY_ENCRYPTION_OLD_KEYS.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	rotate := flag.Bool("rotate-data-keys", false, "give each user a new data key and re-encrypt their history with it")
+	onlyUser := flag.Uint("user", 0, "only process this user ID")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning: .env file not found: %v", err)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := db.Initialize(cfg.DatabaseURL); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	envelope := services.InitHistoryEncryption(cfg)
+	if envelope == nil {
+		log.Fatal("HISTORY_ENCRYPTION_KEY is not set")
+	}
+
+	rewrapped, err := envelope.RewrapDataKeys()
+	if err != nil {
+		log.Fatalf("Failed to re-wrap data keys: %v", err)
+	}
+	log.Printf("Re-wrapped %d data keys with the current master key", rewrapped)
+
+	// Users who encrypt, and users with encrypted rows left over from
+	// before they turned it off
+	var userIDs []uint
+	if err := db.DB.Raw(`
+		SELECT id FROM users WHERE encrypt_history
+		UNION
+		SELECT DISTINCT user_id FROM paraphrase_histories WHERE encrypted`).
+		Scan(&userIDs).Error; err != nil {
+		log.Fatalf("Failed to list users: %v", err)
+	}
+
+	failed := 0
+	for _, userID := range userIDs {
+		if *onlyUser != 0 && userID != *onlyUser {
+			continue
+		}
+
+		if *rotate {
+			if err := envelope.RotateDataKey(userID); err != nil {
+				log.Printf("Error rotating data key for user %d: %v", userID, err)
+				failed++
+				continue
+			}
+		}
+
+		if err := services.ReencryptUserHistory(userID); err != nil {
+			log.Printf("Error re-encrypting history for user %d: %v", userID, err)
+			failed++
+			continue
+		}
+		log.Printf("Processed user %d", userID)
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d users could not be processed", failed)
+	}
+}
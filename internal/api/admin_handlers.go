@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RatingGroup counts the ratings of entries sharing one value of a
+// dimension, such as one style.
+type RatingGroup struct {
+	Key      string  `json:"key"`
+	Up       int     `json:"up"`
+	Down     int     `json:"down"`
+	Total    int     `json:"total"`
+	Approval float64 `json:"approval"` // share of ratings that are up
+}
+
+// Dimensions ratings are broken down by, keyed by response field. Entries
+// created before model and prompt version were recorded show as "unknown".
+var ratingDimensions = map[string]string{
+	"by_style":          "paraphrase_histories.style",
+	"by_language":       "paraphrase_histories.language",
+	"by_mode":           "paraphrase_histories.mode",
+	"by_model":          "COALESCE(NULLIF(paraphrase_histories.model, ''), 'unknown')",
+	"by_prompt_version": "COALESCE(NULLIF(paraphrase_histories.prompt_version, ''), 'unknown')",
+}
+
+// ratingsQuery joins ratings to the entries they rate, narrowed by the
+// from, to, mode, style and language query parameters. Ratings of entries
+// users have since deleted still count towards the statistics.
+func ratingsQuery(c *gin.Context) (*gorm.DB, error) {
+	query := db.DB.Table("ratings").
+		Joins("JOIN paraphrase_histories ON paraphrase_histories.id = ratings.history_id")
+
+	from, err := parseFilterTime(c.Query("from"), false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from date")
+	}
+	to, err := parseFilterTime(c.Query("to"), true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to date")
+	}
+	if from != nil {
+		query = query.Where("ratings.updated_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("ratings.updated_at < ?", *to)
+	}
+
+	for param, column := range map[string]string{
+		"mode":     "paraphrase_histories.mode",
+		"style":    "paraphrase_histories.style",
+		"language": "paraphrase_histories.language",
+	} {
+		if value := c.Query(param); value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+
+	return query, nil
+}
+
+// HandleGetRatingStats aggregates ratings overall and by style, language,
+// mode, model and prompt version, with a count of each down-vote reason.
+func HandleGetRatingStats() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, err := ratingsQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		counts := `COUNT(*) FILTER (WHERE ratings.value = 'up') AS up,
+			COUNT(*) FILTER (WHERE ratings.value = 'down') AS down,
+			COUNT(*) AS total`
+
+		response := gin.H{}
+
+		var overall RatingGroup
+		if err := query.Session(&gorm.Session{}).Select(counts).Scan(&overall).Error; err != nil {
+			log.Printf("Error fetching rating stats: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch rating stats"})
+			return
+		}
+		overall.Key = "all"
+		response["overall"] = withApproval([]RatingGroup{overall})[0]
+
+		for field, column := range ratingDimensions {
+			var groups []RatingGroup
+			if err := query.Session(&gorm.Session{}).
+				Select(column + " AS key, " + counts).
+				Group("key").
+				Order("total DESC").
+				Scan(&groups).Error; err != nil {
+				log.Printf("Error fetching rating stats: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch rating stats"})
+				return
+			}
+			response[field] = withApproval(groups)
+		}
+
+		var reasons []struct {
+			Reason string
+			Count  int
+		}
+		if err := query.Session(&gorm.Session{}).
+			Select("COALESCE(NULLIF(ratings.reason, ''), 'none') AS reason, COUNT(*) AS count").
+			Where("ratings.value = ?", models.RatingDown).
+			Group("1").
+			Scan(&reasons).Error; err != nil {
+			log.Printf("Error fetching rating stats: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch rating stats"})
+			return
+		}
+
+		downReasons := make(map[string]int)
+		for _, r := range reasons {
+			downReasons[r.Reason] = r.Count
+		}
+		response["down_reasons"] = downReasons
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func withApproval(groups []RatingGroup) []RatingGroup {
+	for i := range groups {
+		if groups[i].Total > 0 {
+			groups[i].Approval = float64(groups[i].Up) / float64(groups[i].Total)
+		}
+	}
+	return groups
+}
+
+// lowRatedExample is one line of the low-rated dataset. It carries no
+// user identifiers.
+type lowRatedExample struct {
+	HistoryID       uint      `json:"history_id"`
+	RatedAt         time.Time `json:"rated_at"`
+	Reason          string    `json:"reason,omitempty"`
+	Comment         string    `json:"comment,omitempty"`
+	Mode            string    `json:"mode"`
+	Language        string    `json:"language"`
+	Style           string    `json:"style"`
+	Model           string    `json:"model"`
+	PromptVersion   string    `json:"prompt_version"`
+	OriginalText    string    `json:"original_text"`
+	ParaphrasedText string    `json:"paraphrased_text"`
+}
+
+// HandleExportLowRated streams every down-voted entry as JSON Lines for
+// prompt tuning, narrowed by the same parameters as the stats plus reason.
+// Entries users have deleted, whose text is no longer stored or that are
+// encrypted are left out.
+func HandleExportLowRated() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, err := ratingsQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		query = query.
+			Select(`ratings.history_id, ratings.updated_at AS rated_at, ratings.reason, ratings.comment,
+				paraphrase_histories.mode, paraphrase_histories.language, paraphrase_histories.style,
+				paraphrase_histories.model, paraphrase_histories.prompt_version,
+				paraphrase_histories.original_text, paraphrase_histories.paraphrased_text`).
+			Where("ratings.value = ? AND paraphrase_histories.deleted_at IS NULL AND NOT paraphrase_histories.redacted AND NOT paraphrase_histories.encrypted", models.RatingDown).
+			Order("ratings.id")
+		if reason := c.Query("reason"); reason != "" {
+			query = query.Where("ratings.reason = ?", reason)
+		}
+
+		rows, err := query.Rows()
+		if err != nil {
+			log.Printf("Error exporting ratings: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export ratings"})
+			return
+		}
+		defer rows.Close()
+
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="low-rated-%s.jsonl"`, time.Now().Format("2006-01-02")))
+		c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+		c.Status(http.StatusOK)
+
+		enc := json.NewEncoder(c.Writer)
+		for rows.Next() {
+			var example lowRatedExample
+			if err := db.DB.ScanRows(rows, &example); err != nil {
+				log.Printf("Error exporting ratings: %v", err)
+				return
+			}
+			if err := enc.Encode(example); err != nil {
+				log.Printf("Error exporting ratings: %v", err)
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error exporting ratings: %v", err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/auth"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+const maxAPIKeysPerUser = 20
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=paraphrase history:read"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func HandleGetAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var keys []models.APIKey
+		if err := db.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch API keys"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"keys": keys})
+	}
+}
+
+// HandleCreateAPIKey creates a key and returns it. This is the only time
+// the full key is shown.
+func HandleCreateAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("userID")
+		var req CreateAPIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+			return
+		}
+
+		var count int64
+		if err := db.DB.Model(&models.APIKey{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create API key"})
+			return
+		}
+		if count >= maxAPIKeysPerUser {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "API key limit reached, delete an unused key first"})
+			return
+		}
+
+		key, prefix, err := services.GenerateAPIKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create API key"})
+			return
+		}
+
+		// Drop duplicate scopes
+		var scopes models.APIScopes
+		for _, scope := range req.Scopes {
+			if !scopes.Has(scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+
+		apiKey := models.APIKey{
+			UserID:    userID,
+			Name:      req.Name,
+			Prefix:    prefix,
+			KeyHash:   auth.HashToken(key),
+			Scopes:    scopes,
+			ExpiresAt: req.ExpiresAt,
+		}
+		if err := db.DB.Create(&apiKey).Error; err != nil {
+			log.Printf("Error creating API key: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create API key"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"key":     key,
+			"api_key": apiKey,
+		})
+	}
+}
+
+func HandleDeleteAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid API key id"})
+			return
+		}
+
+		result := db.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.APIKey{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete API key"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "API key deleted"})
+	}
+}
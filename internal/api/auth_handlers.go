@@ -2,14 +2,19 @@ package api
 
 import (
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/arrinal/paraphrase-saas/internal/auth"
 	"github.com/arrinal/paraphrase-saas/internal/config"
 	"github.com/arrinal/paraphrase-saas/internal/db"
 	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type LoginRequest struct {
@@ -17,13 +22,75 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
 type RegisterRequest struct {
 	Name     string `json:"name" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=6"`
 }
 
-func HandleLogin(cfg *config.Config) gin.HandlerFunc {
+// respondWithSession starts a session for user and responds with its
+// tokens.
+func respondWithSession(c *gin.Context, cfg *config.Config, user *models.User, status int) {
+	tokens, err := services.StartSession(cfg, user.ID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		log.Printf("Failed to generate tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
+		return
+	}
+
+	c.JSON(status, gin.H{
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+		"user": gin.H{
+			"id":             user.ID,
+			"name":           user.Name,
+			"email":          user.Email,
+			"email_verified": user.EmailVerified(),
+		},
+	})
+}
+
+// completeLogin finishes a login whose first factor has been checked.
+// With 2FA on, that only earns a short-lived challenge that
+// HandleLoginMFA exchanges for a session.
+func completeLogin(c *gin.Context, cfg *config.Config, user *models.User) {
+	if !user.MFAEnabled() {
+		respondWithSession(c, cfg, user, http.StatusOK)
+		return
+	}
+
+	challenge, err := services.CreateAccountToken(user.ID, models.TokenPurposeMFAChallenge, "", services.MFAChallengeTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start two-factor login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mfa_required": true,
+		"mfa_token":    challenge,
+	})
+}
+
+// dummyPasswordHash is checked when a login has no password to compare
+// against, so an unknown email costs the same bcrypt work as a wrong
+// password. It hashes a random secret that nobody can supply.
+var dummyPasswordHash = func() []byte {
+	secret, err := auth.RandomToken()
+	if err != nil {
+		panic(err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}()
+
+func HandleLogin(cfg *config.Config, guard *services.LoginGuard) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req LoginRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -32,38 +99,73 @@ func HandleLogin(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		log.Printf("Login attempt for email: %s", req.Email)
+		email := services.NormalizeLoginEmail(req.Email)
+		ip := c.ClientIP()
 
-		var user models.User
-		if err := db.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		user, throttle, err := guard.Attempt(email, ip, func() (*models.User, bool, error) {
+			var user *models.User
+			hash := dummyPasswordHash
+			var found models.User
+			if err := db.DB.Where("LOWER(email) = ?", email).Order("id").First(&found).Error; err == nil {
+				user = &found
+				// Accounts that signed up through OIDC have no password
+				if !found.NoPassword && found.Password != "" {
+					hash = []byte(found.Password)
+				}
+			} else if err != gorm.ErrRecordNotFound {
+				return nil, false, err
+			}
+
+			err := bcrypt.CompareHashAndPassword(hash, []byte(req.Password))
+			return user, err == nil && user != nil, nil
+		})
+		if err != nil {
+			log.Printf("Error checking login: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log in"})
 			return
 		}
-
-		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		if throttle != nil {
+			respondThrottled(c, throttle)
+			return
+		}
+		if user == nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 			return
 		}
 
-		token, refreshToken, err := auth.GenerateTokenPair(user.ID, cfg.JWTSecret)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
-			return
+		// With 2FA on the login is not complete until the code is checked
+		if !user.MFAEnabled() {
+			if err := guard.RecordSuccess(email, ip, user.ID); err != nil {
+				log.Printf("Error recording login for user %d: %v", user.ID, err)
+			}
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"token":         token,
-			"refresh_token": refreshToken,
-			"user": gin.H{
-				"id":    user.ID,
-				"name":  user.Name,
-				"email": user.Email,
-			},
+		completeLogin(c, cfg, user)
+	}
+}
+
+// respondThrottled refuses a login that has to wait, without saying
+// whether the account exists.
+func respondThrottled(c *gin.Context, throttle *services.LoginThrottle) {
+	seconds := setRetryAfter(c, throttle.RetryAfter)
+
+	switch {
+	case throttle.Locked:
+		c.JSON(http.StatusLocked, gin.H{
+			"error":       "too many failed attempts, sign-in is temporarily locked",
+			"code":        "ACCOUNT_LOCKED",
+			"retry_after": seconds,
+		})
+	default:
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "too many failed attempts, try again later",
+			"code":        "LOGIN_THROTTLED",
+			"retry_after": seconds,
 		})
 	}
 }
 
-func HandleRegister(cfg *config.Config) gin.HandlerFunc {
+func HandleRegister(cfg *config.Config, mailer services.Mailer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req RegisterRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -72,12 +174,13 @@ func HandleRegister(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		log.Printf("Register attempt for email: %s", req.Email)
+		// Emails are stored and compared in lower case, so addresses that
+		// differ only in case name the same account
+		req.Email = services.NormalizeLoginEmail(req.Email)
 
 		// Check if email already exists
 		var existingUser models.User
-		if err := db.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
-			log.Printf("Email already exists: %s", req.Email)
+		if err := db.DB.Where("LOWER(email) = ?", req.Email).First(&existingUser).Error; err == nil {
 			c.JSON(http.StatusConflict, gin.H{"error": "email already registered"})
 			return
 		}
@@ -102,28 +205,19 @@ func HandleRegister(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		log.Printf("Successfully created user: %s (ID: %d)", user.Email, user.ID)
+		log.Printf("Successfully created user %d", user.ID)
 
-		token, refreshToken, err := auth.GenerateTokenPair(user.ID, cfg.JWTSecret)
-		if err != nil {
-			log.Printf("Failed to generate tokens: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
-			return
+		if err := sendVerificationEmail(cfg, mailer, user.ID, user.Email); err != nil {
+			log.Printf("Failed to send verification email: %v", err)
 		}
 
-		c.JSON(http.StatusCreated, gin.H{
-			"token":         token,
-			"refresh_token": refreshToken,
-			"user": gin.H{
-				"id":    user.ID,
-				"name":  user.Name,
-				"email": user.Email,
-			},
-		})
+		respondWithSession(c, cfg, &user, http.StatusCreated)
 	}
 }
 
-func HandleVerifySession(cfg *config.Config) gin.HandlerFunc {
+// HandleVerifySession returns the signed-in user. It does not issue tokens;
+// clients renew their access token through /auth/refresh.
+func HandleVerifySession() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, exists := c.Get("userID")
 		if !exists {
@@ -139,42 +233,60 @@ func HandleVerifySession(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		// Generate new token
-		token, err := auth.GenerateToken(user.ID, cfg.JWTSecret)
-		if err != nil {
-			log.Printf("Failed to generate token: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
-			return
-		}
-
 		c.JSON(http.StatusOK, gin.H{
-			"token": token,
 			"user": gin.H{
-				"id":    user.ID,
-				"name":  user.Name,
-				"email": user.Email,
+				"id":             user.ID,
+				"name":           user.Name,
+				"email":          user.Email,
+				"email_verified": user.EmailVerified(),
 			},
 		})
 	}
 }
 
+// HandleRefreshToken exchanges a refresh token for a new token pair. The
+// refresh token presented is spent; clients must keep the new one.
 func HandleRefreshToken(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, exists := c.Get("userID")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		var req RefreshTokenRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		// Generate new token
-		token, err := auth.GenerateToken(userID.(uint), cfg.JWTSecret)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		tokens, err := services.RefreshTokens(cfg, req.RefreshToken)
+		switch err {
+		case nil:
+		case services.ErrInvalidRefreshToken:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+			return
+		case services.ErrRefreshTokenReused:
+			log.Printf("Refresh token reuse detected, token family revoked")
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "refresh token has already been used, please log in again",
+				"code":  "REFRESH_TOKEN_REUSED",
+			})
+			return
+		default:
+			log.Printf("Error refreshing tokens: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"token": token,
+			"token":         tokens.Token,
+			"refresh_token": tokens.RefreshToken,
 		})
 	}
 }
+
+// setRetryAfter sets the Retry-After header, in whole seconds, and returns
+// the number of seconds.
+func setRetryAfter(c *gin.Context, wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	return seconds
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Largest document accepted for upload (5 MB)
+const maxDocumentSize = 5 << 20
+
+const jobKindDocumentParaphrase = "document_paraphrase"
+
+func HandleParaphraseDocument(openAIService *services.OpenAIService, jobRunner *services.JobRunner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		language := c.PostForm("language")
+		style := c.PostForm("style")
+		if language == "" || style == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "language and style are required"})
+			return
+		}
+
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+
+		if fileHeader.Size > maxDocumentSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "document exceeds the 5 MB limit"})
+			return
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
+			return
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
+			return
+		}
+
+		doc, err := services.ParseDocument(fileHeader.Filename, data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(doc.Segments) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "document contains no text"})
+			return
+		}
+
+		// Each segment is a separate paraphrase call on the shared job queue
+		limits := c.MustGet("planLimits").(models.PlanLimits)
+		if len(doc.Segments) > limits.MaxDocumentSegments() {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("document has %d segments, your plan allows %d", len(doc.Segments), limits.MaxDocumentSegments()),
+				"code":  "PLAN_RESTRICTION",
+			})
+			return
+		}
+		characters := 0
+		for i, segment := range doc.Segments {
+			length := utf8.RuneCountInString(segment)
+			if limits.CharactersPerRequest > 0 && length > limits.CharactersPerRequest {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+					"error": fmt.Sprintf("segment %d has %d characters, your plan allows %d per request", i+1, length, limits.CharactersPerRequest),
+					"code":  "PLAN_RESTRICTION",
+				})
+				return
+			}
+			characters += length
+		}
+		if characters > limits.MaxDocumentCharacters() {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("document has %d characters, your plan allows %d", characters, limits.MaxDocumentCharacters()),
+				"code":  "PLAN_RESTRICTION",
+			})
+			return
+		}
+
+		// Every segment counts as a request toward the daily limit
+		if limits.RequestsPerDay > 0 {
+			used, err := services.RequestsToday(userID.(uint))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check usage limit"})
+				return
+			}
+			if used+len(doc.Segments) > limits.RequestsPerDay {
+				c.JSON(http.StatusTooManyRequests, gin.H{
+					"error": fmt.Sprintf("document needs %d requests, %d of your %d daily requests are left", len(doc.Segments), max(limits.RequestsPerDay-used, 0), limits.RequestsPerDay),
+					"code":  "DAILY_LIMIT",
+				})
+				return
+			}
+		}
+
+		job := &models.Job{
+			UserID:      userID.(uint),
+			Kind:        jobKindDocumentParaphrase,
+			FileName:    paraphrasedFileName(fileHeader.Filename),
+			ContentType: doc.ContentType(),
+		}
+
+		err = jobRunner.Enqueue(job, func(job *models.Job) error {
+			return paraphraseDocument(job, doc, language, style, openAIService, jobRunner)
+		})
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to queue document"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"job_id":     job.ID,
+			"status":     models.JobStatusQueued,
+			"segments":   len(doc.Segments),
+			"status_url": fmt.Sprintf("/api/jobs/%d", job.ID),
+		})
+	}
+}
+
+// paraphraseDocument paraphrases each segment of doc in turn, renders the
+// result in the original format and records it in the user's history.
+func paraphraseDocument(job *models.Job, doc *services.Document, language, style string, openAIService *services.OpenAIService, jobRunner *services.JobRunner) error {
+	paraphrased := make([]string, len(doc.Segments))
+	flagged := false
+	tokens := 0
+	for i, segment := range doc.Segments {
+		resp, err := openAIService.Paraphrase(segment, language, style)
+		if err != nil {
+			return fmt.Errorf("failed to paraphrase segment %d: %v", i+1, err)
+		}
+		paraphrased[i] = resp.Paraphrased
+		flagged = flagged || resp.Verification.Flagged
+		tokens += resp.TokensUsed
+
+		// Keep the rest of the document in the language detected first
+		if language == "auto" && resp.DetectedLanguage != "" {
+			language = resp.DetectedLanguage
+		}
+
+		jobRunner.UpdateProgress(job, i+1, len(doc.Segments))
+	}
+
+	result, err := doc.Render(paraphrased)
+	if err != nil {
+		return fmt.Errorf("failed to render document: %v", err)
+	}
+
+	original := doc.Text()
+	output := strings.Join(paraphrased, "\n\n")
+	history := models.ParaphraseHistory{
+		UserID:          job.UserID,
+		OriginalText:    original,
+		ParaphrasedText: output,
+		Language:        language,
+		Style:           style,
+		Mode:            models.HistoryModeParaphrase,
+		Model:           services.OpenAIModel,
+		PromptVersion:   services.PromptVersion,
+		Metrics:         services.ComputeQualityMetrics(original, output, style, nil),
+		Flagged:         flagged,
+		TokensUsed:      tokens,
+		Requests:        len(doc.Segments),
+	}
+	if err := db.DB.Create(&history).Error; err != nil {
+		return fmt.Errorf("failed to save history: %v", err)
+	}
+
+	job.HistoryID = &history.ID
+	return jobRunner.SaveResult(job, result)
+}
+
+func paraphrasedFileName(name string) string {
+	name = strings.ReplaceAll(filepath.Base(name), `"`, "")
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-paraphrased" + ext
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Exports of more entries than this run as a background job
+const exportInlineLimit = 2000
+
+const jobKindHistoryExport = "history_export"
+
+// HandleExportHistory exports the user's history as csv, jsonl or docx,
+// narrowed by the same filters as the history list. Small exports are
+// streamed in the response; large ones, or any with async=true, are queued
+// as a job whose result is downloaded from the job's download link.
+func HandleExportHistory(jobRunner *services.JobRunner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		format := c.DefaultQuery("format", services.ExportFormatCSV)
+		contentType, ok := services.ExportContentType(format)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, jsonl or docx"})
+			return
+		}
+
+		filter, err := parseHistoryFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		query := func() *gorm.DB {
+			return filter.apply(db.DB.Model(&models.ParaphraseHistory{}).Where("user_id = ?", userID))
+		}
+
+		var total int64
+		if err := query().Count(&total).Error; err != nil {
+			log.Printf("Error counting history for export: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export history"})
+			return
+		}
+
+		fileName := fmt.Sprintf("history-%s.%s", time.Now().Format("2006-01-02"), format)
+
+		if total > exportInlineLimit || c.Query("async") == "true" {
+			job := &models.Job{
+				UserID:      userID.(uint),
+				Kind:        jobKindHistoryExport,
+				FileName:    fileName,
+				ContentType: contentType,
+			}
+
+			err := jobRunner.Enqueue(job, func(job *models.Job) error {
+				f, err := jobRunner.CreateResultFile(job)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				w := bufio.NewWriter(f)
+				if err := services.ExportHistory(w, format, query(), func(done int) {
+					jobRunner.UpdateProgress(job, done, int(total))
+				}); err != nil {
+					return fmt.Errorf("failed to export history: %v", err)
+				}
+				if err := w.Flush(); err != nil {
+					return fmt.Errorf("failed to write export: %v", err)
+				}
+				return f.Close()
+			})
+			if err != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to queue export"})
+				return
+			}
+
+			c.JSON(http.StatusAccepted, gin.H{
+				"job_id":     job.ID,
+				"status":     models.JobStatusQueued,
+				"entries":    total,
+				"status_url": fmt.Sprintf("/api/jobs/%d", job.ID),
+			})
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+		c.Header("Content-Type", contentType)
+		c.Status(http.StatusOK)
+
+		// Headers are already sent, so a failure can only cut the file short
+		if err := services.ExportHistory(c.Writer, format, query(), func(int) {
+			c.Writer.Flush()
+		}); err != nil {
+			log.Printf("Error exporting history: %v", err)
+		}
+	}
+}
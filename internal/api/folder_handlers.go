@@ -0,0 +1,250 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FolderRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+type FolderItemsRequest struct {
+	HistoryIDs []uint `json:"history_ids" binding:"required,min=1,max=100"`
+}
+
+// FolderSummary is a folder with the number of entries in history it holds.
+type FolderSummary struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	ItemCount int       `json:"item_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// findFolder loads one of the user's folders. It responds with an error and
+// returns false if there is no such folder.
+func findFolder(c *gin.Context, userID interface{}) (*models.Folder, bool) {
+	var folder models.Folder
+	if err := db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		First(&folder).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "folder not found"})
+		return nil, false
+	}
+	return &folder, true
+}
+
+// folderNameTaken reports whether the user has another folder called name.
+func folderNameTaken(userID interface{}, name string, exceptID uint) (bool, error) {
+	var count int64
+	err := db.DB.Model(&models.Folder{}).
+		Where("user_id = ? AND name = ? AND id <> ?", userID, name, exceptID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func HandleGetFolders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var folders []FolderSummary
+		if err := db.DB.Model(&models.Folder{}).
+			Select(`folders.id, folders.name, folders.created_at, folders.updated_at,
+				COUNT(paraphrase_histories.id) AS item_count`).
+			Joins("LEFT JOIN folder_items ON folder_items.folder_id = folders.id").
+			Joins("LEFT JOIN paraphrase_histories ON paraphrase_histories.id = folder_items.history_id AND paraphrase_histories.deleted_at IS NULL").
+			Where("folders.user_id = ?", userID).
+			Group("folders.id").
+			Order("folders.name").
+			Scan(&folders).Error; err != nil {
+			log.Printf("Error fetching folders: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch folders"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"folders": folders})
+	}
+}
+
+func HandleCreateFolder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var req FolderRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+			return
+		}
+
+		taken, err := folderNameTaken(userID, name, 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create folder"})
+			return
+		}
+		if taken {
+			c.JSON(http.StatusConflict, gin.H{"error": "a folder with this name already exists"})
+			return
+		}
+
+		folder := models.Folder{UserID: userID.(uint), Name: name}
+		if err := db.DB.Create(&folder).Error; err != nil {
+			log.Printf("Error creating folder: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create folder"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"folder": folder})
+	}
+}
+
+func HandleRenameFolder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var req FolderRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+			return
+		}
+
+		folder, ok := findFolder(c, userID)
+		if !ok {
+			return
+		}
+
+		taken, err := folderNameTaken(userID, name, folder.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rename folder"})
+			return
+		}
+		if taken {
+			c.JSON(http.StatusConflict, gin.H{"error": "a folder with this name already exists"})
+			return
+		}
+
+		folder.Name = name
+		if err := db.DB.Save(folder).Error; err != nil {
+			log.Printf("Error renaming folder: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rename folder"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"folder": folder})
+	}
+}
+
+// HandleDeleteFolder deletes a folder. The entries in it stay in history.
+func HandleDeleteFolder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		folder, ok := findFolder(c, userID)
+		if !ok {
+			return
+		}
+
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("folder_id = ?", folder.ID).Delete(&models.FolderItem{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(folder).Error
+		})
+		if err != nil {
+			log.Printf("Error deleting folder: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete folder"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "folder deleted"})
+	}
+}
+
+// HandleAddFolderItems puts entries into a folder. Entries already in it,
+// and IDs that are not the user's, are skipped.
+func HandleAddFolderItems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var req FolderItemsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		folder, ok := findFolder(c, userID)
+		if !ok {
+			return
+		}
+
+		var ids []uint
+		if err := db.DB.Model(&models.ParaphraseHistory{}).
+			Where("user_id = ? AND id IN ?", userID, req.HistoryIDs).
+			Pluck("id", &ids).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add to folder"})
+			return
+		}
+		if len(ids) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "history entries not found"})
+			return
+		}
+
+		items := make([]models.FolderItem, len(ids))
+		for i, id := range ids {
+			items[i] = models.FolderItem{FolderID: folder.ID, HistoryID: id}
+		}
+
+		result := db.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&items)
+		if result.Error != nil {
+			log.Printf("Error adding to folder: %v", result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add to folder"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"added": result.RowsAffected})
+	}
+}
+
+func HandleRemoveFolderItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		folder, ok := findFolder(c, userID)
+		if !ok {
+			return
+		}
+
+		result := db.DB.Where("folder_id = ? AND history_id = ?", folder.ID, c.Param("historyId")).
+			Delete(&models.FolderItem{})
+		if result.Error != nil {
+			log.Printf("Error removing from folder: %v", result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove from folder"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "entry is not in this folder"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "removed from folder"})
+	}
+}
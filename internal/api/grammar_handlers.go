@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+func HandleCorrectGrammar(openAIService *services.OpenAIService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		reqValue, exists := c.Get("parsedRequest")
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+
+		req := reqValue.(struct {
+			Text     string `json:"text" binding:"required"`
+			Language string `json:"language" binding:"required"`
+		})
+
+		grammarResp, err := openAIService.CorrectGrammar(req.Text, req.Language)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to correct text"})
+			return
+		}
+
+		history := models.ParaphraseHistory{
+			UserID:          userID.(uint),
+			OriginalText:    req.Text,
+			ParaphrasedText: grammarResp.Corrected,
+			Language:        grammarResp.DetectedLanguage,
+			Mode:            models.HistoryModeGrammar,
+			Model:           services.OpenAIModel,
+			PromptVersion:   services.PromptVersion,
+			Edits:           grammarResp.Edits,
+			TokensUsed:      grammarResp.TokensUsed,
+		}
+
+		if err := db.DB.Create(&history).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save history"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"corrected":  grammarResp.Corrected,
+			"language":   grammarResp.DetectedLanguage,
+			"edits":      grammarResp.Edits,
+			"history_id": history.ID,
+		})
+	}
+}
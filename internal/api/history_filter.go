@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultHistoryPageSize = 20
+	maxHistoryPageSize     = 100
+)
+
+// HistoryFilter narrows a user's history. It is parsed from query
+// parameters and shared by every endpoint that lists history.
+type HistoryFilter struct {
+	Language  string
+	Style     string
+	Mode      string
+	From      *time.Time
+	To        *time.Time
+	Favorites bool
+	Tag       string
+	FolderID  *uint
+}
+
+// parseHistoryFilter reads language, style, mode, from, to, favorites, tag
+// and folder_id from the query string. Dates may be RFC 3339 or YYYY-MM-DD;
+// a bare "to" date includes that whole day.
+func parseHistoryFilter(c *gin.Context) (HistoryFilter, error) {
+	f := HistoryFilter{
+		Language: c.Query("language"),
+		Style:    c.Query("style"),
+		Mode:     c.Query("mode"),
+	}
+
+	var err error
+	if f.From, err = parseFilterTime(c.Query("from"), false); err != nil {
+		return f, fmt.Errorf("invalid from date")
+	}
+	if f.To, err = parseFilterTime(c.Query("to"), true); err != nil {
+		return f, fmt.Errorf("invalid to date")
+	}
+
+	if v := c.Query("favorites"); v != "" {
+		if f.Favorites, err = strconv.ParseBool(v); err != nil {
+			return f, fmt.Errorf("invalid favorites value")
+		}
+	}
+
+	if v := c.Query("tag"); v != "" {
+		f.Tag = normalizeTagName(v)
+	}
+
+	if v := c.Query("folder_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid folder_id")
+		}
+		folderID := uint(id)
+		f.FolderID = &folderID
+	}
+
+	return f, nil
+}
+
+func parseFilterTime(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+func (f HistoryFilter) apply(query *gorm.DB) *gorm.DB {
+	if f.Language != "" {
+		query = query.Where("language = ?", f.Language)
+	}
+	if f.Style != "" {
+		query = query.Where("style = ?", f.Style)
+	}
+	if f.Mode != "" {
+		query = query.Where("mode = ?", f.Mode)
+	}
+	if f.From != nil {
+		query = query.Where("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("created_at < ?", *f.To)
+	}
+	if f.Favorites {
+		query = query.Where("is_favorite = ?", true)
+	}
+	// Tags and folders only match those owned by the entry's user
+	if f.Tag != "" {
+		query = query.Where(`EXISTS (SELECT 1 FROM history_tags ht JOIN tags t ON t.id = ht.tag_id
+			WHERE ht.history_id = paraphrase_histories.id AND t.user_id = paraphrase_histories.user_id AND t.name = ?)`, f.Tag)
+	}
+	if f.FolderID != nil {
+		query = query.Where(`EXISTS (SELECT 1 FROM folder_items fi JOIN folders f ON f.id = fi.folder_id
+			WHERE fi.history_id = paraphrase_histories.id AND f.user_id = paraphrase_histories.user_id AND f.id = ?)`, *f.FolderID)
+	}
+	return query
+}
+
+// historyCursor marks the last row of a page in (created_at, id) order.
+type historyCursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+func (cur historyCursor) encode() string {
+	raw := fmt.Sprintf("%d:%d", cur.CreatedAt.UnixNano(), cur.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeHistoryCursor(value string) (*historyCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &historyCursor{CreatedAt: time.Unix(0, nanos), ID: uint(id)}, nil
+}
+
+// parsePageSize reads the limit parameter, capped at maxHistoryPageSize.
+func parsePageSize(c *gin.Context) (int, error) {
+	value := c.Query("limit")
+	if value == "" {
+		return defaultHistoryPageSize, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("invalid limit")
+	}
+	if limit > maxHistoryPageSize {
+		limit = maxHistoryPageSize
+	}
+	return limit, nil
+}
+
+// parseOffset reads the offset parameter for endpoints paged by offset.
+func parseOffset(c *gin.Context) (int, error) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid offset")
+	}
+	return offset, nil
+}
@@ -4,27 +4,129 @@ import (
 	"log"
 	"net/http"
 
-	"github.com/gin-gonic/gin"
 	"github.com/arrinal/paraphrase-saas/internal/db"
 	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// HandleGetHistory returns one page of the user's history in (created_at,
+// id) order. Pass next_cursor back as cursor to get the following page.
+// Query parameters: limit, cursor, sort (newest or oldest), include_total,
+// and the filters read by parseHistoryFilter.
 func HandleGetHistory() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _ := c.Get("userID")
 
+		filter, err := parseHistoryFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		limit, err := parsePageSize(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ascending := false
+		switch c.DefaultQuery("sort", "newest") {
+		case "newest":
+		case "oldest":
+			ascending = true
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be newest or oldest"})
+			return
+		}
+
+		query := filter.apply(db.DB.Model(&models.ParaphraseHistory{}).Where("user_id = ?", userID))
+
+		response := gin.H{}
+		if c.Query("include_total") == "true" {
+			var total int64
+			if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+				log.Printf("Error counting history: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch history"})
+				return
+			}
+			response["total"] = total
+		}
+
+		if value := c.Query("cursor"); value != "" {
+			cursor, err := decodeHistoryCursor(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+				return
+			}
+			if ascending {
+				query = query.Where("(created_at, id) > (?, ?)", cursor.CreatedAt, cursor.ID)
+			} else {
+				query = query.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+			}
+		}
+
+		order := "created_at desc, id desc"
+		if ascending {
+			order = "created_at asc, id asc"
+		}
+
+		// Fetch one extra row to learn whether there is another page
 		var history []models.ParaphraseHistory
-		if err := db.DB.Where("user_id = ?", userID).
-			Order("created_at desc").
-			Find(&history).Error; err != nil {
+		if err := query.Order(order).Limit(limit + 1).Find(&history).Error; err != nil {
 			log.Printf("Error fetching history: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch history"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"history": history,
-		})
+		hasMore := len(history) > limit
+		if hasMore {
+			history = history[:limit]
+			last := history[len(history)-1]
+			response["next_cursor"] = historyCursor{CreatedAt: last.CreatedAt, ID: last.ID}.encode()
+		}
+
+		if err := loadHistoryTags(history); err != nil {
+			log.Printf("Error fetching history tags: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch history"})
+			return
+		}
+
+		response["history"] = history
+		response["has_more"] = hasMore
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+type FavoriteRequest struct {
+	Favorite bool `json:"favorite"`
+}
+
+// HandleSetFavorite stars or unstars a history entry.
+func HandleSetFavorite() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var req FavoriteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result := db.DB.Model(&models.ParaphraseHistory{}).
+			Where("id = ? AND user_id = ?", c.Param("id"), userID).
+			Update("is_favorite", req.Favorite)
+		if result.Error != nil {
+			log.Printf("Error updating favorite: %v", result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update favorite"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "history entry not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"is_favorite": req.Favorite})
 	}
 }
 
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+func HandleGetJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var job models.Job
+		if err := db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+			First(&job).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+
+		response := gin.H{"job": job}
+		if job.Status == models.JobStatusCompleted && job.ResultPath != "" {
+			response["download_url"] = fmt.Sprintf("/api/jobs/%d/download", job.ID)
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// HandleDownloadJobResult serves a job's result file. Result files are not
+// encrypted, so for users who encrypt their history or don't keep it the
+// file is removed once it has been downloaded.
+func HandleDownloadJobResult() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var job models.Job
+		if err := db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+			First(&job).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+
+		if job.Status != models.JobStatusCompleted {
+			c.JSON(http.StatusConflict, gin.H{"error": "job result is not ready"})
+			return
+		}
+		if job.ResultPath == "" {
+			c.JSON(http.StatusGone, gin.H{"error": "job result has expired"})
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, job.FileName))
+		c.Header("Content-Type", job.ContentType)
+		c.File(job.ResultPath)
+
+		var user models.User
+		if err := db.DB.Select("id", "encrypt_history", "history_retention").First(&user, userID).Error; err != nil {
+			log.Printf("Error loading user %v after job download: %v", userID, err)
+			return
+		}
+		if user.EncryptHistory || user.HistoryRetention == models.RetentionNone {
+			services.RemoveJobResult(&job)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/auth"
+	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errInvalidSecondFactor = errors.New("invalid password or code")
+	errMFANotEnabled       = errors.New("two-factor authentication is not enabled")
+)
+
+type ConfirmMFARequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFAReauthRequest re-checks both factors before 2FA settings change.
+// Code may be a TOTP code or a recovery code.
+type MFAReauthRequest struct {
+	Password string `json:"password"` // not needed by accounts without one
+	Code     string `json:"code" binding:"required"`
+}
+
+func HandleGetMFAStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var user models.User
+		if err := db.DB.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+
+		var remaining int64
+		if err := db.DB.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Count(&remaining).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch two-factor status"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"enabled":                  user.MFAEnabled(),
+			"enabled_at":               user.TOTPEnabledAt,
+			"recovery_codes_remaining": remaining,
+		})
+	}
+}
+
+// HandleSetupMFA starts enrolment with a new secret. It has no effect on
+// login until confirmed with a code from the authenticator.
+func HandleSetupMFA(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var user models.User
+		if err := db.DB.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if user.MFAEnabled() {
+			c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+			return
+		}
+
+		secret, err := auth.GenerateTOTPSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate secret"})
+			return
+		}
+
+		if err := db.DB.Model(&user).Update("totp_pending_secret", secret).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start two-factor setup"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"secret":      secret,
+			"otpauth_uri": auth.TOTPProvisioningURI(cfg.AppName, user.Email, secret),
+		})
+	}
+}
+
+// HandleConfirmMFA turns 2FA on once the user proves their authenticator
+// works, and returns their recovery codes.
+func HandleConfirmMFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		var req ConfirmMFARequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user models.User
+		if err := db.DB.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if user.MFAEnabled() {
+			c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+			return
+		}
+		if user.TOTPPendingSecret == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "two-factor setup has not been started"})
+			return
+		}
+
+		step, ok := auth.ValidateTOTP(user.TOTPPendingSecret, req.Code, time.Now())
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+			return
+		}
+
+		var codes []string
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			if err := tx.Model(&user).Updates(map[string]interface{}{
+				"totp_secret":         user.TOTPPendingSecret,
+				"totp_pending_secret": "",
+				"totp_enabled_at":     now,
+				"totp_last_step":      step,
+			}).Error; err != nil {
+				return err
+			}
+
+			var err error
+			codes, err = services.ReplaceRecoveryCodes(tx, user.ID)
+			return err
+		})
+		if err != nil {
+			log.Printf("Error enabling two-factor authentication for user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable two-factor authentication"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "two-factor authentication enabled",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// reauthenticate checks the password and a second factor of the signed-in
+// user, spending the code, and returns the user locked within tx. Accounts
+// made through a sign-in provider have no password, so only the second
+// factor is checked for them. 2FA must be enabled.
+func reauthenticate(tx *gorm.DB, userID interface{}, req MFAReauthRequest) (*models.User, error) {
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	if !user.NoPassword {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+			return nil, errInvalidSecondFactor
+		}
+	}
+	if !user.MFAEnabled() {
+		return nil, errMFANotEnabled
+	}
+
+	ok, err := services.VerifySecondFactor(tx, &user, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errInvalidSecondFactor
+	}
+	return &user, nil
+}
+
+// reauthError writes the response for a failed reauthenticate.
+func reauthError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, errInvalidSecondFactor):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errMFANotEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("Error trying to %s: %v", action, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to " + action})
+}
+
+func HandleDisableMFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		var req MFAReauthRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			user, err := reauthenticate(tx, userID, req)
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Model(user).Updates(map[string]interface{}{
+				"totp_secret":     "",
+				"totp_enabled_at": nil,
+				"totp_last_step":  0,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+		})
+		if err != nil {
+			reauthError(c, err, "disable two-factor authentication")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+	}
+}
+
+func HandleRegenerateRecoveryCodes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		var req MFAReauthRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var codes []string
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			user, err := reauthenticate(tx, userID, req)
+			if err != nil {
+				return err
+			}
+
+			codes, err = services.ReplaceRecoveryCodes(tx, user.ID)
+			return err
+		})
+		if err != nil {
+			reauthError(c, err, "regenerate recovery codes")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+// HandleLoginMFA completes a login that passed the password check by
+// exchanging the challenge token and a second factor for a session.
+func HandleLoginMFA(cfg *config.Config, guard *services.LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LoginMFARequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user models.User
+		challenge, err := services.FindAccountToken(req.MFAToken, models.TokenPurposeMFAChallenge)
+		if err == nil {
+			err = db.DB.First(&user, challenge.UserID).Error
+		}
+		if errors.Is(err, services.ErrInvalidAccountToken) || errors.Is(err, gorm.ErrRecordNotFound) {
+			respondMFAChallengeExpired(c)
+			return
+		}
+		if err != nil {
+			log.Printf("Error loading two-factor challenge: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify code"})
+			return
+		}
+
+		// Wrong codes count against the account like wrong passwords, so
+		// fresh challenges don't give a way around the limit
+		email := services.NormalizeLoginEmail(user.Email)
+		ip := c.ClientIP()
+		verified, throttle, err := guard.Attempt(email, ip, func() (*models.User, bool, error) {
+			passed := false
+			err := db.DB.Transaction(func(tx *gorm.DB) error {
+				challenge, err := services.LockAccountToken(tx, req.MFAToken, models.TokenPurposeMFAChallenge)
+				if err != nil {
+					return err
+				}
+
+				passed, err = services.VerifySecondFactor(tx, &user, req.Code)
+				if err != nil {
+					return err
+				}
+
+				// Spend the challenge on success, or after too many wrong codes
+				updates := map[string]interface{}{"attempts": challenge.Attempts + 1}
+				if passed || challenge.Attempts+1 >= services.MaxMFAAttempts {
+					updates["used_at"] = time.Now()
+				}
+				return tx.Model(challenge).Updates(updates).Error
+			})
+			return &user, passed, err
+		})
+		if errors.Is(err, services.ErrInvalidAccountToken) {
+			respondMFAChallengeExpired(c)
+			return
+		}
+		if err != nil {
+			log.Printf("Error verifying second factor: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify code"})
+			return
+		}
+		if throttle != nil {
+			respondThrottled(c, throttle)
+			return
+		}
+		if verified == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+			return
+		}
+
+		if err := guard.RecordSuccess(email, ip, user.ID); err != nil {
+			log.Printf("Error recording login for user %d: %v", user.ID, err)
+		}
+
+		respondWithSession(c, cfg, &user, http.StatusOK)
+	}
+}
+
+func respondMFAChallengeExpired(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error": "login has expired, please sign in again",
+		"code":  "MFA_CHALLENGE_EXPIRED",
+	})
+}
@@ -0,0 +1,361 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/auth"
+	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A sign-in must come back from the provider within this time
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	errOIDCStateInvalid    = errors.New("sign-in has expired, please try again")
+	errOIDCEmailUnverified = errors.New("the provider did not share a verified email address")
+	errOIDCAccountExists   = errors.New("an account with this email already exists; sign in with your password and link the provider from your settings")
+	errOIDCIdentityTaken   = errors.New("this provider account is already linked to another user")
+)
+
+// OIDCCallbackRequest carries what the provider sent back, along with the
+// binding value the start endpoint gave this browser. Without the binding
+// a code and state obtained by someone else could be replayed here to sign
+// the browser in as them, or to link their provider account.
+type OIDCCallbackRequest struct {
+	Code    string `json:"code" binding:"required"`
+	State   string `json:"state" binding:"required"`
+	Binding string `json:"binding" binding:"required"`
+}
+
+func HandleGetOIDCProviders(oidc *services.OIDCService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"providers": oidc.ProviderNames()})
+	}
+}
+
+// HandleStartOIDCLogin returns the provider URL to send the user to, and a
+// binding value the frontend keeps and sends back with the callback.
+func HandleStartOIDCLogin(oidc *services.OIDCService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startOIDC(c, oidc, nil)
+	}
+}
+
+// HandleLinkOIDCProvider is HandleStartOIDCLogin for a signed-in user
+// adding a provider to their account.
+func HandleLinkOIDCProvider(oidc *services.OIDCService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("userID")
+		startOIDC(c, oidc, &userID)
+	}
+}
+
+func startOIDC(c *gin.Context, oidc *services.OIDCService, linkUserID *uint) {
+	provider, ok := oidc.Provider(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown sign-in provider"})
+		return
+	}
+
+	state, err := auth.RandomToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start sign-in"})
+		return
+	}
+	nonce, err := auth.RandomToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start sign-in"})
+		return
+	}
+	binding, err := auth.RandomToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start sign-in"})
+		return
+	}
+	verifier, challenge, err := services.NewPKCEVerifier()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start sign-in"})
+		return
+	}
+
+	authURL, err := provider.AuthURL(state, nonce, challenge)
+	if err != nil {
+		log.Printf("Error starting %s sign-in: %v", c.Param("provider"), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "sign-in provider is unavailable"})
+		return
+	}
+
+	if err := db.DB.Create(&models.OIDCLoginState{
+		StateHash:    auth.HashToken(state),
+		BindingHash:  auth.HashToken(binding),
+		Provider:     c.Param("provider"),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start sign-in"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"url": authURL, "binding": binding})
+}
+
+// HandleOIDCCallback finishes a sign-in once the provider sends the user
+// back with a code. It either logs the user in or, if the sign-in was
+// started to link the provider, links it.
+func HandleOIDCCallback(cfg *config.Config, oidc *services.OIDCService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req OIDCCallbackRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		providerName := c.Param("provider")
+		provider, ok := oidc.Provider(providerName)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown sign-in provider"})
+			return
+		}
+
+		// Each state works once
+		var state models.OIDCLoginState
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("state_hash = ? AND provider = ?", auth.HashToken(req.State), providerName).
+				First(&state).Error; err != nil {
+				return errOIDCStateInvalid
+			}
+			if err := tx.Delete(&state).Error; err != nil {
+				return err
+			}
+			if state.ExpiresAt.Before(time.Now()) {
+				return errOIDCStateInvalid
+			}
+			// Only the browser that started the sign-in may finish it
+			if subtle.ConstantTimeCompare([]byte(state.BindingHash), []byte(auth.HashToken(req.Binding))) != 1 {
+				return errOIDCStateInvalid
+			}
+			return nil
+		})
+		if err != nil {
+			oidcError(c, err)
+			return
+		}
+
+		claims, err := provider.Exchange(req.Code, state.CodeVerifier, state.Nonce)
+		if err != nil {
+			log.Printf("Error completing %s sign-in: %v", providerName, err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "sign-in with the provider failed"})
+			return
+		}
+
+		if state.LinkUserID != nil {
+			identity, err := linkIdentity(*state.LinkUserID, providerName, claims)
+			if err != nil {
+				oidcError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"identity": identity})
+			return
+		}
+
+		user, err := resolveOIDCUser(providerName, claims)
+		if err != nil {
+			oidcError(c, err)
+			return
+		}
+
+		completeLogin(c, cfg, user)
+	}
+}
+
+func oidcError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errOIDCStateInvalid), errors.Is(err, errOIDCEmailUnverified):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errOIDCAccountExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "ACCOUNT_EXISTS"})
+	case errors.Is(err, errOIDCIdentityTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error completing provider sign-in: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to complete sign-in"})
+	}
+}
+
+// linkIdentity adds the provider account to userID, or refreshes the link
+// if it is already theirs.
+func linkIdentity(userID uint, provider string, claims *services.IDTokenClaims) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := db.DB.Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error
+	switch {
+	case err == nil:
+		if identity.UserID != userID {
+			return nil, errOIDCIdentityTaken
+		}
+		return &identity, db.DB.Model(&identity).Update("email", claims.Email).Error
+	case err != gorm.ErrRecordNotFound:
+		return nil, err
+	}
+
+	identity = models.UserIdentity{UserID: userID, Provider: provider, Subject: claims.Subject, Email: claims.Email}
+	return &identity, db.DB.Create(&identity).Error
+}
+
+// resolveOIDCUser finds the user a provider account signs in as. An
+// unknown provider account is linked to the user with the same verified
+// email, or else a new user is created for it.
+func resolveOIDCUser(provider string, claims *services.IDTokenClaims) (*models.User, error) {
+	var user models.User
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error
+		if err == nil {
+			if err := tx.Model(&identity).Updates(map[string]interface{}{
+				"email":         claims.Email,
+				"last_login_at": now,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.First(&user, identity.UserID).Error
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		if !claims.EmailVerified || claims.Email == "" {
+			return errOIDCEmailUnverified
+		}
+
+		err = tx.Where("LOWER(email) = LOWER(?)", claims.Email).First(&user).Error
+		switch {
+		case err == nil:
+			// Only an address the user proved to us can vouch for the link;
+			// otherwise whoever registered it first would get the account
+			if !user.EmailVerified() {
+				return errOIDCAccountExists
+			}
+		case err == gorm.ErrRecordNotFound:
+			if err := createOIDCUser(tx, &user, claims); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    provider,
+			Subject:     claims.Subject,
+			Email:       claims.Email,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func createOIDCUser(tx *gorm.DB, user *models.User, claims *services.IDTokenClaims) error {
+	// Nobody knows this password; the user can set one by resetting it
+	random, err := auth.RandomToken()
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(random), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	name := claims.Name
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	now := time.Now()
+	*user = models.User{
+		Name:            name,
+		Email:           claims.Email,
+		Password:        string(hashedPassword),
+		NoPassword:      true,
+		EmailVerifiedAt: &now,
+	}
+	return tx.Create(user).Error
+}
+
+func HandleGetIdentities() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var identities []models.UserIdentity
+		if err := db.DB.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch linked accounts"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"identities": identities})
+	}
+}
+
+// HandleUnlinkIdentity removes a linked provider, unless it is the only
+// way into an account that has no password.
+func HandleUnlinkIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid identity id"})
+			return
+		}
+
+		var user models.User
+		if err := db.DB.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+
+		var identity models.UserIdentity
+		if err := db.DB.Where("id = ? AND user_id = ?", id, user.ID).First(&identity).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "linked account not found"})
+			return
+		}
+
+		if user.NoPassword {
+			var count int64
+			if err := db.DB.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlink account"})
+				return
+			}
+			if count <= 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "set a password before unlinking your only sign-in method"})
+				return
+			}
+		}
+
+		if err := db.DB.Delete(&identity).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlink account"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "account unlinked"})
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+func HandleTextOperation(openAIService *services.OpenAIService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		reqValue, exists := c.Get("parsedRequest")
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+
+		req := reqValue.(struct {
+			Operation    string   `json:"operation" binding:"required,oneof=paraphrase summarize expand simplify change_tone"`
+			Text         string   `json:"text" binding:"required"`
+			Language     string   `json:"language" binding:"required"`
+			Style        string   `json:"style"`
+			Tone         string   `json:"tone" binding:"omitempty,oneof=formal casual friendly confident empathetic persuasive neutral"`
+			TargetLength int      `json:"target_length" binding:"omitempty,min=10,max=2000"`
+			TargetGrade  *float64 `json:"target_grade" binding:"omitempty,min=1,max=18"`
+			ParentID     *uint    `json:"parent_id"`
+		})
+
+		// A regeneration becomes a revision of the entry it replaces
+		var parent *models.ParaphraseHistory
+		if req.ParentID != nil {
+			var ok bool
+			if parent, ok = findParentEntry(c, userID, *req.ParentID); !ok {
+				return
+			}
+		}
+
+		op := services.TextOperation{
+			Operation:    req.Operation,
+			Text:         req.Text,
+			Language:     req.Language,
+			Style:        req.Style,
+			Tone:         req.Tone,
+			TargetLength: req.TargetLength,
+			TargetGrade:  req.TargetGrade,
+		}
+		if op.Operation == models.HistoryModeSummarize && op.TargetLength == 0 {
+			op.TargetLength = services.DefaultSummaryLength(op.Text)
+		}
+
+		resp, err := openAIService.RunTextOperation(op)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process text"})
+			return
+		}
+
+		// Style holds the paraphrase style, or the tone for change_tone
+		style := req.Style
+		if op.Operation == models.HistoryModeChangeTone {
+			style = req.Tone
+		}
+
+		history := models.ParaphraseHistory{
+			UserID:          userID.(uint),
+			OriginalText:    req.Text,
+			ParaphrasedText: resp.Paraphrased,
+			Language:        resp.DetectedLanguage,
+			Style:           style,
+			Mode:            op.Operation,
+			Model:           services.OpenAIModel,
+			PromptVersion:   services.PromptVersion,
+			TargetLength:    op.TargetLength,
+			TokensUsed:      resp.TokensUsed,
+			Metrics:         services.ComputeQualityMetrics(req.Text, resp.Paraphrased, style, req.TargetGrade),
+		}
+		if resp.Verification != nil {
+			history.Flagged = resp.Verification.Flagged
+		}
+
+		if parent != nil {
+			err = createRevision(&history, parent)
+		} else {
+			err = db.DB.Create(&history).Error
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save history"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"operation":        op.Operation,
+			"result":           resp.Paraphrased,
+			"language":         resp.DetectedLanguage,
+			"history_id":       history.ID,
+			"metrics":          history.Metrics,
+			"quality_warnings": resp.QualityWarnings,
+			"verification":     resp.Verification,
+		})
+	}
+}
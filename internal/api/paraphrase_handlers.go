@@ -10,9 +10,11 @@ import (
 )
 
 type ParaphraseRequest struct {
-	Text     string `json:"text" binding:"required"`
-	Language string `json:"language" binding:"required"`
-	Style    string `json:"style" binding:"required"`
+	Text        string   `json:"text" binding:"required"`
+	Language    string   `json:"language" binding:"required"`
+	Style       string   `json:"style" binding:"required"`
+	TargetGrade *float64 `json:"target_grade" binding:"omitempty,min=1,max=18"`
+	ParentID    *uint    `json:"parent_id"`
 }
 
 type ParaphraseResponse struct {
@@ -32,13 +34,26 @@ func HandleParaphrase(openAIService *services.OpenAIService) gin.HandlerFunc {
 		}
 
 		req := reqValue.(struct {
-			Text     string `json:"text" binding:"required"`
-			Language string `json:"language" binding:"required"`
-			Style    string `json:"style" binding:"required"`
+			Text        string   `json:"text" binding:"required"`
+			Language    string   `json:"language" binding:"required"`
+			Style       string   `json:"style" binding:"required"`
+			TargetGrade *float64 `json:"target_grade" binding:"omitempty,min=1,max=18"`
+			ParentID    *uint    `json:"parent_id"`
 		})
 
+		// A regeneration becomes a revision of the entry it replaces
+		var parent *models.ParaphraseHistory
+		if req.ParentID != nil {
+			var ok bool
+			if parent, ok = findParentEntry(c, userID, *req.ParentID); !ok {
+				return
+			}
+		}
+
 		// Paraphrase the text
-		paraphrasedResp, err := openAIService.Paraphrase(req.Text, req.Language, req.Style)
+		paraphrasedResp, err := openAIService.ParaphraseWithOptions(req.Text, req.Language, req.Style, services.ParaphraseOptions{
+			TargetGrade: req.TargetGrade,
+		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to paraphrase text"})
 			return
@@ -51,17 +66,32 @@ func HandleParaphrase(openAIService *services.OpenAIService) gin.HandlerFunc {
 			ParaphrasedText: paraphrasedResp.Paraphrased,
 			Language:        paraphrasedResp.DetectedLanguage,
 			Style:           req.Style,
+			Mode:            models.HistoryModeParaphrase,
+			Model:           services.OpenAIModel,
+			PromptVersion:   services.PromptVersion,
+			Metrics:         services.ComputeQualityMetrics(req.Text, paraphrasedResp.Paraphrased, req.Style, req.TargetGrade),
+			Flagged:         paraphrasedResp.Verification.Flagged,
+			TokensUsed:      paraphrasedResp.TokensUsed,
 		}
 
-		if err := db.DB.Create(&history).Error; err != nil {
+		if parent != nil {
+			err = createRevision(&history, parent)
+		} else {
+			err = db.DB.Create(&history).Error
+		}
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save history"})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"paraphrased": paraphrasedResp.Paraphrased,
-			"language":    paraphrasedResp.DetectedLanguage,
-			"history_id":  history.ID,
+			"paraphrased":      paraphrasedResp.Paraphrased,
+			"language":         paraphrasedResp.DetectedLanguage,
+			"history_id":       history.ID,
+			"metrics":          history.Metrics,
+			"quality_warnings": paraphrasedResp.QualityWarnings,
+			"attempts":         paraphrasedResp.Attempts,
+			"verification":     paraphrasedResp.Verification,
 		})
 	}
 }
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// HandleForgotPassword emails a reset link if the address belongs to an
+// account. The response is the same either way, so it cannot be used to
+// find out who is registered.
+func HandleForgotPassword(cfg *config.Config, mailer services.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ForgotPasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user models.User
+		err := db.DB.Where("LOWER(email) = ?", services.NormalizeLoginEmail(req.Email)).First(&user).Error
+		if err == nil {
+			token, err := services.CreateAccountToken(user.ID, models.TokenPurposePasswordReset, user.Email, services.PasswordResetTokenTTL)
+			if err != nil {
+				log.Printf("Error creating password reset token for user %d: %v", user.ID, err)
+			} else {
+				services.SendEmailAsync(mailer, services.PasswordResetEmail(cfg, user.Email, token))
+			}
+		} else if err != gorm.ErrRecordNotFound {
+			log.Printf("Error looking up user for password reset: %v", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "if an account exists for that email, a reset link has been sent",
+		})
+	}
+}
+
+// HandleResetPassword sets a new password using an emailed token and ends
+// every session, since whoever held the old password may be signed in.
+func HandleResetPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ResetPasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+			return
+		}
+
+		var userID uint
+		err = db.DB.Transaction(func(tx *gorm.DB) error {
+			token, err := services.ConsumeAccountToken(tx, req.Token, models.TokenPurposePasswordReset)
+			if err != nil {
+				return err
+			}
+			userID = token.UserID
+			if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+				"password":    string(hashedPassword),
+				"no_password": false,
+			}).Error; err != nil {
+				return err
+			}
+
+			// Receiving the link proves the address, if it is still the
+			// account's
+			return tx.Model(&models.User{}).
+				Where("id = ? AND email = ? AND email_verified_at IS NULL", userID, token.Email).
+				Update("email_verified_at", time.Now()).Error
+		})
+		if err == services.ErrInvalidAccountToken {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reset link is invalid or has expired"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error resetting password: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+			return
+		}
+
+		if _, err := services.RevokeUserSessions(userID, 0); err != nil {
+			log.Printf("Error revoking sessions for user %d: %v", userID, err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "password has been reset"})
+	}
+}
+
+type UnlockAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// HandleUnlockAccount lifts a login lockout using the link emailed when it
+// started.
+func HandleUnlockAccount(guard *services.LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req UnlockAccountRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := guard.Unlock(req.Token, c.ClientIP())
+		if err == services.ErrInvalidAccountToken {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unlock link is invalid or has expired"})
+			return
+		}
+		if err != nil {
+			log.Printf("Error unlocking account: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock account"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "account unlocked, you can sign in again"})
+	}
+}
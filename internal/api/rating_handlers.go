@@ -0,0 +1,75 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+type RatingRequest struct {
+	Value   string `json:"value" binding:"required,oneof=up down"`
+	Reason  string `json:"reason" binding:"omitempty,oneof=meaning_changed too_similar wrong_language other"`
+	Comment string `json:"comment" binding:"max=1000"`
+}
+
+// HandleRateHistory records the user's thumbs up or down on an entry,
+// replacing any earlier rating of it.
+func HandleRateHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var req RatingRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var entry models.ParaphraseHistory
+		if err := db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+			First(&entry).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "history entry not found"})
+			return
+		}
+
+		rating := models.Rating{
+			UserID:    entry.UserID,
+			HistoryID: entry.ID,
+			Value:     req.Value,
+			Reason:    req.Reason,
+			Comment:   req.Comment,
+		}
+		if err := db.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "history_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"value", "reason", "comment", "updated_at"}),
+		}).Create(&rating).Error; err != nil {
+			log.Printf("Error saving rating: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save rating"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"rating": rating})
+	}
+}
+
+func HandleDeleteRating() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		result := db.DB.Where("history_id = ? AND user_id = ?", c.Param("id"), userID).
+			Delete(&models.Rating{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete rating"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "rating not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "rating deleted"})
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RevisionNode is a history entry with the revisions derived from it.
+// Deleted marks a root that is in the trash but still holds the tree
+// together.
+type RevisionNode struct {
+	models.ParaphraseHistory
+	Deleted  bool            `json:"deleted,omitempty"`
+	Children []*RevisionNode `json:"children"`
+}
+
+type ManualEditRequest struct {
+	Text string `json:"text" binding:"required"`
+}
+
+// createRevision saves history as a child revision of parent, numbering it
+// after the newest revision in parent's tree.
+func createRevision(history *models.ParaphraseHistory, parent *models.ParaphraseHistory) error {
+	rootID := parent.ID
+	if parent.RootID != nil {
+		rootID = *parent.RootID
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		// Holding the root row serialises revisions of one tree, so two
+		// saves cannot take the same number
+		if err := tx.Exec("SELECT 1 FROM paraphrase_histories WHERE id = ? FOR UPDATE", rootID).Error; err != nil {
+			return err
+		}
+
+		var latest int
+		if err := tx.Model(&models.ParaphraseHistory{}).
+			Where("id = ? OR root_id = ?", rootID, rootID).
+			Select("COALESCE(MAX(revision), 1)").
+			Scan(&latest).Error; err != nil {
+			return err
+		}
+
+		history.ParentID = &parent.ID
+		history.RootID = &rootID
+		history.Revision = latest + 1
+		return tx.Create(history).Error
+	})
+}
+
+// findParentEntry loads the history entry a new revision derives from. It
+// responds with an error and returns false if parentID is not the user's.
+func findParentEntry(c *gin.Context, userID interface{}, parentID uint) (*models.ParaphraseHistory, bool) {
+	var parent models.ParaphraseHistory
+	if err := db.DB.Where("id = ? AND user_id = ?", parentID, userID).
+		First(&parent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "parent history entry not found"})
+		return nil, false
+	}
+	return &parent, true
+}
+
+func HandleGetRevisions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var entry models.ParaphraseHistory
+		if err := db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+			First(&entry).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "history entry not found"})
+			return
+		}
+
+		rootID := entry.ID
+		if entry.RootID != nil {
+			rootID = *entry.RootID
+		}
+
+		// The root is loaded even from the trash, since it anchors the tree
+		var revisions []models.ParaphraseHistory
+		if err := db.DB.Unscoped().
+			Where("user_id = ? AND (id = ? OR (root_id = ? AND deleted_at IS NULL))", userID, rootID, rootID).
+			Order("revision asc").
+			Find(&revisions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch revisions"})
+			return
+		}
+
+		nodes := make(map[uint]*RevisionNode, len(revisions))
+		for i := range revisions {
+			nodes[revisions[i].ID] = &RevisionNode{
+				ParaphraseHistory: revisions[i],
+				Deleted:           revisions[i].DeletedAt.Valid,
+				Children:          []*RevisionNode{},
+			}
+		}
+
+		// Once the root has been purged the oldest remaining revision
+		// takes its place
+		root := nodes[rootID]
+		if root == nil {
+			root = nodes[revisions[0].ID]
+		}
+
+		// A parent that was deleted leaves its children attached to the root
+		for _, r := range revisions {
+			node := nodes[r.ID]
+			if node == root {
+				continue
+			}
+			parent := root
+			if r.ParentID != nil && nodes[*r.ParentID] != nil {
+				parent = nodes[*r.ParentID]
+			}
+			parent.Children = append(parent.Children, node)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"root":  root,
+			"count": len(revisions),
+		})
+	}
+}
+
+func HandleSaveManualEdit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var req ManualEditRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var parent models.ParaphraseHistory
+		if err := db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+			First(&parent).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "history entry not found"})
+			return
+		}
+
+		if parent.Redacted {
+			c.JSON(http.StatusConflict, gin.H{"error": "the text of this entry is not stored"})
+			return
+		}
+
+		history := models.ParaphraseHistory{
+			UserID:          parent.UserID,
+			OriginalText:    parent.OriginalText,
+			ParaphrasedText: req.Text,
+			Language:        parent.Language,
+			Style:           parent.Style,
+			Mode:            models.HistoryModeEdit,
+			Metrics:         services.ComputeQualityMetrics(parent.OriginalText, req.Text, parent.Style, nil),
+		}
+		if err := createRevision(&history, &parent); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save edit"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"history": history})
+	}
+}
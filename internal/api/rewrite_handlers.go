@@ -0,0 +1,135 @@
+package api
+
+import (
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+func HandleRewriteSpan(openAIService *services.OpenAIService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		reqValue, exists := c.Get("parsedRequest")
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+
+		req := reqValue.(struct {
+			SentenceIndex *int   `json:"sentence_index" binding:"omitempty,min=0"`
+			Start         *int   `json:"start" binding:"omitempty,min=0"`
+			End           *int   `json:"end" binding:"omitempty,min=0"`
+			Style         string `json:"style"`
+		})
+
+		var parent models.ParaphraseHistory
+		if err := db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+			First(&parent).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "history entry not found"})
+			return
+		}
+
+		if parent.Redacted {
+			c.JSON(http.StatusConflict, gin.H{"error": "the text of this entry is not stored"})
+			return
+		}
+
+		// The rewrite prompt paraphrases in the entry's style, which is only
+		// right for paraphrased text. Manual edits keep the mode they were
+		// made on, so look through them.
+		source := models.ParaphraseHistory{ID: parent.ID, ParentID: parent.ParentID, Mode: parent.Mode}
+		for source.Mode == models.HistoryModeEdit && source.ParentID != nil {
+			var next models.ParaphraseHistory
+			if err := db.DB.Unscoped().Select("id", "parent_id", "mode").
+				Where("id = ? AND user_id = ?", *source.ParentID, userID).
+				First(&next).Error; err != nil {
+				break
+			}
+			source = next
+		}
+		switch source.Mode {
+		case models.HistoryModeParaphrase, models.HistoryModeRewrite, models.HistoryModeEdit, "":
+		default:
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "only paraphrased text can be partly rewritten",
+				"code":  "UNSUPPORTED_MODE",
+			})
+			return
+		}
+
+		text := parent.ParaphrasedText
+		var span services.TextSpan
+		switch {
+		case req.SentenceIndex != nil:
+			sentences := services.SentenceSpans(text)
+			if *req.SentenceIndex >= len(sentences) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "sentence_index out of range"})
+				return
+			}
+			span = sentences[*req.SentenceIndex]
+		case req.Start != nil && req.End != nil:
+			var ok bool
+			span, ok = services.RuneRangeToBytes(text, *req.Start, *req.End)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid character range"})
+				return
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sentence_index or start and end are required"})
+			return
+		}
+
+		style := req.Style
+		if style == "" {
+			style = parent.Style
+		}
+		if style == "" {
+			style = "standard"
+		}
+
+		replacement, tokens, err := openAIService.RewriteSpan(text, span, parent.Language, style)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rewrite text"})
+			return
+		}
+
+		rewritten := text[:span.Start] + replacement + text[span.End:]
+
+		history := models.ParaphraseHistory{
+			UserID:          parent.UserID,
+			OriginalText:    parent.OriginalText,
+			ParaphrasedText: rewritten,
+			Language:        parent.Language,
+			Style:           style,
+			Mode:            models.HistoryModeRewrite,
+			Model:           services.OpenAIModel,
+			PromptVersion:   services.PromptVersion,
+			Metrics:         services.ComputeQualityMetrics(parent.OriginalText, rewritten, style, nil),
+			TokensUsed:      tokens,
+		}
+
+		if err := createRevision(&history, &parent); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save history"})
+			return
+		}
+
+		start := utf8.RuneCountInString(text[:span.Start])
+		c.JSON(http.StatusOK, gin.H{
+			"paraphrased": rewritten,
+			"history_id":  history.ID,
+			"parent_id":   parent.ID,
+			"rewritten": gin.H{
+				"start":    start,
+				"end":      start + utf8.RuneCountInString(replacement),
+				"original": text[span.Start:span.End],
+				"text":     replacement,
+			},
+			"metrics": history.Metrics,
+		})
+	}
+}
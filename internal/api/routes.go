@@ -3,6 +3,7 @@ package api
 import (
 	"github.com/arrinal/paraphrase-saas/internal/config"
 	"github.com/arrinal/paraphrase-saas/internal/middleware"
+	"github.com/arrinal/paraphrase-saas/internal/models"
 	"github.com/arrinal/paraphrase-saas/internal/services"
 	"github.com/gin-gonic/gin"
 )
@@ -10,32 +11,117 @@ import (
 func SetupRoutes(r *gin.Engine, cfg *config.Config) {
 	// Initialize services
 	openAIService := services.NewOpenAIService(cfg)
+	services.InitHistoryEncryption(cfg)
+	jobRunner := services.NewJobRunner(cfg, 2)
+	mailer := services.NewMailer(cfg)
+	oidcService := services.NewOIDCService(cfg)
+	apiKeyLimiter := services.NewRateLimiter(cfg.APIKeyRateLimit)
+	loginGuard := services.NewLoginGuard(cfg, mailer)
+	services.StartTrashPurge(cfg)
+	services.StartRetentionPurge()
+	services.StartTokenPurge()
+	services.StartJobPurge()
 
 	// Auth routes (public)
 	auth := r.Group("/api/auth")
 	{
-		auth.POST("/login", HandleLogin(cfg))
-		auth.POST("/register", HandleRegister(cfg))
-		auth.GET("/verify", middleware.AuthRequired(cfg), HandleVerifySession(cfg))
-		auth.POST("/refresh", middleware.AuthRequired(cfg), HandleRefreshToken(cfg))
+		auth.POST("/login", HandleLogin(cfg, loginGuard))
+		auth.POST("/unlock", HandleUnlockAccount(loginGuard))
+		auth.POST("/login/mfa", HandleLoginMFA(cfg, loginGuard))
+		auth.POST("/register", HandleRegister(cfg, mailer))
+		auth.GET("/verify", middleware.AuthRequired(cfg), HandleVerifySession())
+		auth.POST("/refresh", HandleRefreshToken(cfg))
+		auth.POST("/forgot-password", HandleForgotPassword(cfg, mailer))
+		auth.POST("/reset-password", HandleResetPassword())
+		auth.POST("/verify-email", HandleVerifyEmail())
+		auth.POST("/resend-verification", middleware.AuthRequired(cfg), HandleResendVerification(cfg, mailer))
+		auth.POST("/logout", middleware.AuthRequired(cfg), HandleLogout())
+		auth.POST("/logout-all", middleware.AuthRequired(cfg), HandleLogoutAll())
+		auth.GET("/sessions", middleware.AuthRequired(cfg), HandleGetSessions())
+		auth.DELETE("/sessions/:id", middleware.AuthRequired(cfg), HandleRevokeSession())
+		auth.GET("/oidc/providers", HandleGetOIDCProviders(oidcService))
+		auth.GET("/oidc/:provider/start", HandleStartOIDCLogin(oidcService))
+		auth.POST("/oidc/:provider/callback", HandleOIDCCallback(cfg, oidcService))
+		auth.GET("/identities", middleware.AuthRequired(cfg), HandleGetIdentities())
+		auth.POST("/identities/:provider", middleware.AuthRequired(cfg), HandleLinkOIDCProvider(oidcService))
+		auth.DELETE("/identities/:id", middleware.AuthRequired(cfg), HandleUnlinkIdentity())
+	}
+
+	// Two-factor authentication
+	mfa := r.Group("/api/auth/2fa")
+	mfa.Use(middleware.AuthRequired(cfg))
+	{
+		mfa.GET("", HandleGetMFAStatus())
+		mfa.POST("/setup", HandleSetupMFA(cfg))
+		mfa.POST("/confirm", HandleConfirmMFA())
+		mfa.POST("/disable", HandleDisableMFA())
+		mfa.POST("/recovery-codes", HandleRegenerateRecoveryCodes())
 	}
 
 	// Protected routes
 	api := r.Group("/api")
 	api.Use(middleware.AuthRequired(cfg))
 	{
-		api.POST("/paraphrase", middleware.CheckSubscriptionLimits(), HandleParaphrase(openAIService))
-		api.GET("/history", HandleGetHistory())
+		api.POST("/operations", middleware.CheckOperationLimits(), HandleTextOperation(openAIService))
+		api.POST("/grammar", middleware.CheckGrammarLimits(), HandleCorrectGrammar(openAIService))
+		api.POST("/documents/paraphrase", middleware.CheckDocumentLimits(), HandleParaphraseDocument(openAIService, jobRunner))
+		api.GET("/jobs/:id", HandleGetJob())
+		api.GET("/jobs/:id/download", HandleDownloadJobResult())
+		api.GET("/history/export", HandleExportHistory(jobRunner))
+		api.GET("/history/trash", HandleGetTrash(cfg))
+		api.POST("/history/bulk-delete", HandleBulkDeleteHistory())
+		api.DELETE("/history/:id", HandleDeleteHistory())
+		api.POST("/history/:id/restore", HandleRestoreHistory(cfg))
+		api.PUT("/history/:id/favorite", HandleSetFavorite())
+		api.PUT("/history/:id/tags", HandleSetHistoryTags())
+		api.PUT("/history/:id/rating", HandleRateHistory())
+		api.DELETE("/history/:id/rating", HandleDeleteRating())
+		api.POST("/history/:id/shares", HandleCreateShareLink(cfg))
+		api.GET("/history/:id/shares", HandleGetShareLinks())
+		api.DELETE("/shares/:id", HandleRevokeShareLink())
+		api.POST("/history/:id/edits", HandleSaveManualEdit())
+		api.POST("/history/:id/rewrite", middleware.CheckRewriteLimits(), HandleRewriteSpan(openAIService))
+		api.GET("/tags", HandleGetTagCloud())
+		api.DELETE("/tags/:name", HandleDeleteTag())
+		api.GET("/folders", HandleGetFolders())
+		api.POST("/folders", HandleCreateFolder())
+		api.PUT("/folders/:id", HandleRenameFolder())
+		api.DELETE("/folders/:id", HandleDeleteFolder())
+		api.POST("/folders/:id/items", HandleAddFolderItems())
+		api.DELETE("/folders/:id/items/:historyId", HandleRemoveFolderItem())
 		api.GET("/languages", HandleGetUsedLanguages())
 		api.GET("/stats", HandleGetUserStats())
-		api.PUT("/settings", HandleUpdateSettings())
+		api.PUT("/settings", HandleUpdateSettings(cfg, mailer))
 		api.GET("/subscription", HandleGetSubscription())
 		api.POST("/subscription/cancel", HandleCancelSubscription(cfg))
-		api.POST("/checkout/session", HandleCreateCheckoutSession(cfg))
+		api.POST("/checkout/session", middleware.EmailVerifiedRequired(), HandleCreateCheckoutSession(cfg))
 		api.POST("/ios/verify-receipt", HandleVerifyIOSReceipt(cfg))
 		api.GET("/subscription/check", HandleCheckSubscription())
+		api.GET("/keys", HandleGetAPIKeys())
+		api.POST("/keys", HandleCreateAPIKey())
+		api.DELETE("/keys/:id", HandleDeleteAPIKey())
+	}
+
+	// Protected routes that API keys with the given scope may also call
+	keyed := r.Group("/api")
+	{
+		keyed.POST("/paraphrase", middleware.APIKeyOrAuthRequired(cfg, apiKeyLimiter, models.ScopeParaphrase), middleware.CheckSubscriptionLimits(), HandleParaphrase(openAIService))
+		keyed.GET("/history", middleware.APIKeyOrAuthRequired(cfg, apiKeyLimiter, models.ScopeHistoryRead), HandleGetHistory())
+		keyed.GET("/history/search", middleware.APIKeyOrAuthRequired(cfg, apiKeyLimiter, models.ScopeHistoryRead), HandleSearchHistory())
+		keyed.GET("/history/:id/revisions", middleware.APIKeyOrAuthRequired(cfg, apiKeyLimiter, models.ScopeHistoryRead), HandleGetRevisions())
 	}
 
+	// Admin routes
+	admin := r.Group("/api/admin")
+	admin.Use(middleware.AuthRequired(cfg), middleware.AdminRequired(cfg))
+	{
+		admin.GET("/ratings/stats", HandleGetRatingStats())
+		admin.GET("/ratings/export", HandleExportLowRated())
+	}
+
+	// Shared results (public)
+	r.GET("/api/share/:token", HandleViewShareLink())
+
 	// Paddle webhook (public)
 	r.POST("/api/webhook/paddle", HandleWebhook(cfg))
 }
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"html"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const maxSearchQueryLength = 200
+
+// ts_headline marks matches with these control characters; they are
+// swapped for <mark> tags after the snippet has been HTML-escaped.
+const (
+	highlightStart = "\x01"
+	highlightStop  = "\x02"
+)
+
+var headlineOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop +
+	", MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=\" … \""
+
+type HistorySearchResult struct {
+	ID                 uint      `json:"id"`
+	OriginalText       string    `json:"original_text"`
+	ParaphrasedText    string    `json:"paraphrased_text"`
+	Language           string    `json:"language"`
+	Style              string    `json:"style"`
+	Mode               string    `json:"mode"`
+	CreatedAt          time.Time `json:"created_at"`
+	Rank               float64   `json:"rank"`
+	OriginalSnippet    string    `json:"original_snippet"`
+	ParaphrasedSnippet string    `json:"paraphrased_snippet"`
+}
+
+// HandleSearchHistory runs a full-text search over the user's history and
+// returns ranked results with highlighted, HTML-safe snippets. The same
+// filters as the history list apply; limit and offset page the results.
+func HandleSearchHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		q := strings.TrimSpace(c.Query("q"))
+		if q == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+			return
+		}
+		if len(q) > maxSearchQueryLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "q is too long"})
+			return
+		}
+
+		// Encrypted text cannot be indexed, so search is off while
+		// encryption is on
+		var user models.User
+		if err := db.DB.Select("encrypt_history").First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if user.EncryptHistory {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "search is not available while history encryption is on",
+				"code":  "SEARCH_DISABLED",
+			})
+			return
+		}
+
+		filter, err := parseHistoryFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		limit, err := parsePageSize(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		offset, err := parseOffset(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Rows are indexed with their own language's configuration, so the
+		// query is parsed with every configuration the user's history uses
+		languages := []string{filter.Language}
+		if filter.Language == "" {
+			if err := db.DB.Model(&models.ParaphraseHistory{}).
+				Where("user_id = ?", userID).
+				Distinct().
+				Pluck("language", &languages).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search history"})
+				return
+			}
+		}
+
+		configs := map[string]bool{"simple": true}
+		for _, language := range languages {
+			configs[db.SearchConfig(language)] = true
+		}
+
+		var tsquery []string
+		var args []interface{}
+		for config := range configs {
+			tsquery = append(tsquery, "websearch_to_tsquery('"+config+"', ?)")
+			args = append(args, q)
+		}
+
+		query := filter.apply(db.DB.Model(&models.ParaphraseHistory{}).Where("user_id = ?", userID))
+
+		var results []HistorySearchResult
+		if err := query.
+			Joins("CROSS JOIN (SELECT "+strings.Join(tsquery, " || ")+" AS query) AS search", args...).
+			Where("search_vector @@ search.query AND NOT encrypted").
+			Select(`paraphrase_histories.id, original_text, paraphrased_text, language, style, mode, created_at,
+				ts_rank_cd(search_vector, search.query) AS rank,
+				ts_headline(history_search_config(language), original_text, search.query, ?) AS original_snippet,
+				ts_headline(history_search_config(language), paraphrased_text, search.query, ?) AS paraphrased_snippet`,
+				headlineOptions, headlineOptions).
+			Order("rank DESC, created_at DESC").
+			Limit(limit).
+			Offset(offset).
+			Scan(&results).Error; err != nil {
+			log.Printf("Error searching history: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search history"})
+			return
+		}
+
+		for i := range results {
+			results[i].OriginalSnippet = highlightSnippet(results[i].OriginalSnippet)
+			results[i].ParaphrasedSnippet = highlightSnippet(results[i].ParaphrasedSnippet)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"results": results,
+			"query":   q,
+		})
+	}
+}
+
+func highlightSnippet(snippet string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").
+		Replace(html.EscapeString(snippet))
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type SessionInfo struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// HandleGetSessions lists the user's active sessions, most recently used
+// first.
+func HandleGetSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		current := c.GetUint("sessionID")
+
+		var sessions []models.Session
+		if err := db.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+			Order("last_seen_at DESC").
+			Find(&sessions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch sessions"})
+			return
+		}
+
+		infos := make([]SessionInfo, len(sessions))
+		for i, s := range sessions {
+			infos[i] = SessionInfo{Session: s, Current: s.ID == current}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"sessions": infos})
+	}
+}
+
+func HandleRevokeSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("userID")
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+			return
+		}
+
+		revoked, err := services.RevokeSession(userID, uint(id))
+		if err != nil {
+			log.Printf("Error revoking session %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+			return
+		}
+		if !revoked {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+	}
+}
+
+// HandleLogout ends the current session.
+func HandleLogout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := services.RevokeSession(c.GetUint("userID"), c.GetUint("sessionID")); err != nil {
+			log.Printf("Error logging out: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log out"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+	}
+}
+
+// HandleLogoutAll ends every session of the user, including this one.
+func HandleLogoutAll() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		revoked, err := services.RevokeUserSessions(c.GetUint("userID"), 0)
+		if err != nil {
+			log.Printf("Error logging out everywhere: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log out"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "logged out everywhere",
+			"revoked": revoked,
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package api
 
 import (
+	"log"
 	"net/http"
 
+	"github.com/arrinal/paraphrase-saas/internal/config"
 	"github.com/arrinal/paraphrase-saas/internal/db"
 	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -14,9 +17,16 @@ type UpdateSettingsRequest struct {
 	Email           string `json:"email"`
 	CurrentPassword string `json:"currentPassword,omitempty"`
 	NewPassword     string `json:"newPassword,omitempty"`
+
+	// HistoryRetention is forever, days or none; days needs HistoryRetentionDays
+	HistoryRetention     string `json:"historyRetention" binding:"omitempty,oneof=forever days none"`
+	HistoryRetentionDays int    `json:"historyRetentionDays" binding:"omitempty,min=1,max=3650"`
+
+	// EncryptHistory stores history text encrypted; search is unavailable while on
+	EncryptHistory *bool `json:"encryptHistory"`
 }
 
-func HandleUpdateSettings() gin.HandlerFunc {
+func HandleUpdateSettings(cfg *config.Config, mailer services.Mailer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _ := c.Get("userID")
 		var req UpdateSettingsRequest
@@ -31,16 +41,19 @@ func HandleUpdateSettings() gin.HandlerFunc {
 			return
 		}
 
-		// If changing password, verify current password
+		// If changing password, verify current password. Accounts made
+		// through a sign-in provider have none to verify.
 		if req.NewPassword != "" {
-			if req.CurrentPassword == "" {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "current password required"})
-				return
-			}
+			if !user.NoPassword {
+				if req.CurrentPassword == "" {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "current password required"})
+					return
+				}
 
-			if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid current password"})
-				return
+				if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+					c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid current password"})
+					return
+				}
 			}
 
 			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
@@ -49,20 +62,48 @@ func HandleUpdateSettings() gin.HandlerFunc {
 				return
 			}
 			user.Password = string(hashedPassword)
+			user.NoPassword = false
 		}
 
 		// Update user details
 		if req.Name != "" {
 			user.Name = req.Name
 		}
-		if req.Email != "" {
+		// A new email only takes effect once it is verified
+		emailChanged := false
+		req.Email = services.NormalizeLoginEmail(req.Email)
+		if req.Email == services.NormalizeLoginEmail(user.Email) {
+			user.PendingEmail = ""
+		} else if req.Email != "" {
 			// Check if email is already taken
 			var existingUser models.User
-			if err := db.DB.Where("email = ? AND id != ?", req.Email, userID).First(&existingUser).Error; err == nil {
+			if err := db.DB.Where("LOWER(email) = ? AND id != ?", req.Email, userID).First(&existingUser).Error; err == nil {
 				c.JSON(http.StatusConflict, gin.H{"error": "email already in use"})
 				return
 			}
-			user.Email = req.Email
+			emailChanged = req.Email != user.PendingEmail
+			user.PendingEmail = req.Email
+		}
+
+		if req.HistoryRetention != "" {
+			if req.HistoryRetention == models.RetentionDays && req.HistoryRetentionDays == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "historyRetentionDays is required for days retention"})
+				return
+			}
+			user.HistoryRetention = req.HistoryRetention
+			user.HistoryRetentionDays = 0
+			if req.HistoryRetention == models.RetentionDays {
+				user.HistoryRetentionDays = req.HistoryRetentionDays
+			}
+		}
+
+		encryptionChanged := req.EncryptHistory != nil && *req.EncryptHistory != user.EncryptHistory
+		if encryptionChanged {
+			if *req.EncryptHistory && models.HistoryCipher == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "history encryption is not available"})
+				return
+			}
+			user.EncryptHistory = *req.EncryptHistory
 		}
 
 		if err := db.DB.Save(&user).Error; err != nil {
@@ -70,12 +111,55 @@ func HandleUpdateSettings() gin.HandlerFunc {
 			return
 		}
 
+		if emailChanged {
+			if err := sendVerificationEmail(cfg, mailer, user.ID, user.PendingEmail); err != nil {
+				log.Printf("Error sending verification email for user %d: %v", user.ID, err)
+			}
+		}
+
+		// A new password ends every other session
+		if req.NewPassword != "" {
+			if _, err := services.RevokeUserSessions(user.ID, c.GetUint("sessionID")); err != nil {
+				log.Printf("Error revoking sessions for user %d: %v", user.ID, err)
+			}
+		}
+
+		// Existing history is converted in the background; new entries follow
+		// the setting straight away
+		if encryptionChanged {
+			go func(userID uint) {
+				if err := services.ReencryptUserHistory(userID); err != nil {
+					log.Printf("Error re-encrypting history for user %d: %v", userID, err)
+				}
+			}(user.ID)
+		}
+
+		// Apply a stricter retention right away rather than at the next
+		// purge. The user must not be told their history is gone if it isn't.
+		if user.HistoryRetention != models.RetentionForever {
+			if err := services.EnforceRetention(&user.ID); err != nil {
+				log.Printf("Error enforcing history retention for user %d: %v", user.ID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "settings were saved, but existing history could not be removed yet; it will be retried",
+					"code":  "RETENTION_FAILED",
+				})
+				return
+			}
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"message": "settings updated successfully",
 			"user": gin.H{
 				"id":    user.ID,
 				"name":  user.Name,
 				"email": user.Email,
+
+				"emailVerified": user.EmailVerified(),
+				"pendingEmail":  user.PendingEmail,
+
+				"historyRetention":     user.HistoryRetention,
+				"historyRetentionDays": user.HistoryRetentionDays,
+				"encryptHistory":       user.EncryptHistory,
 			},
 		})
 	}
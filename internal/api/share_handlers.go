@@ -0,0 +1,204 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/auth"
+	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type CreateShareRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+	Password  string     `json:"password" binding:"omitempty,min=4,max=72"`
+}
+
+// HandleCreateShareLink creates a public read-only link to a history entry.
+// The token is only returned here.
+func HandleCreateShareLink(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var req CreateShareRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+			return
+		}
+
+		var entry models.ParaphraseHistory
+		if err := db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+			First(&entry).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "history entry not found"})
+			return
+		}
+
+		if entry.Redacted {
+			c.JSON(http.StatusConflict, gin.H{"error": "the text of this entry is not stored"})
+			return
+		}
+
+		token, err := auth.RandomToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create share link"})
+			return
+		}
+
+		link := models.ShareLink{
+			UserID:    entry.UserID,
+			HistoryID: entry.ID,
+			TokenHash: auth.HashToken(token),
+			ExpiresAt: req.ExpiresAt,
+		}
+
+		if req.Password != "" {
+			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create share link"})
+				return
+			}
+			link.PasswordHash = string(hashedPassword)
+			link.HasPassword = true
+		}
+
+		if err := db.DB.Create(&link).Error; err != nil {
+			log.Printf("Error creating share link: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create share link"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"share": link,
+			"token": token,
+			"url":   fmt.Sprintf("%s/share/%s", cfg.FrontendURL, token),
+		})
+	}
+}
+
+// HandleGetShareLinks lists the links created for a history entry,
+// including revoked and expired ones.
+func HandleGetShareLinks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var links []models.ShareLink
+		if err := db.DB.Where("history_id = ? AND user_id = ?", c.Param("id"), userID).
+			Order("created_at desc").
+			Find(&links).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch share links"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"shares": links})
+	}
+}
+
+func HandleRevokeShareLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		result := db.DB.Model(&models.ShareLink{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), userID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			log.Printf("Error revoking share link: %v", result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke share link"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "share link not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "share link revoked"})
+	}
+}
+
+// HandleViewShareLink is the public view of a shared entry: the original,
+// the result and a word diff between them. Password-protected links need
+// the password in the X-Share-Password header; wrong guesses are throttled
+// per link and per IP. Every successful view is counted.
+func HandleViewShareLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var link models.ShareLink
+		if err := db.DB.Where("token_hash = ?", auth.HashToken(c.Param("token"))).
+			First(&link).Error; err != nil || !link.Active() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "share link not found or expired"})
+			return
+		}
+
+		if link.HasPassword {
+			password := c.GetHeader("X-Share-Password")
+			if password == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error": "password required",
+					"code":  "PASSWORD_REQUIRED",
+				})
+				return
+			}
+			ok, retryAfter, err := services.CheckSharePassword(&link, c.ClientIP(), func() bool {
+				return bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) == nil
+			})
+			if err != nil {
+				log.Printf("Error checking share link password: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check password"})
+				return
+			}
+			if retryAfter > 0 {
+				seconds := setRetryAfter(c, retryAfter)
+				c.JSON(http.StatusTooManyRequests, gin.H{
+					"error":       "too many wrong passwords, try again later",
+					"code":        "TOO_MANY_ATTEMPTS",
+					"retry_after": seconds,
+				})
+				return
+			}
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error": "invalid password",
+					"code":  "PASSWORD_REQUIRED",
+				})
+				return
+			}
+		}
+
+		// A deleted or redacted entry is no longer shared
+		var entry models.ParaphraseHistory
+		if err := db.DB.Where("id = ? AND user_id = ? AND NOT redacted", link.HistoryID, link.UserID).
+			First(&entry).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "share link not found or expired"})
+			return
+		}
+
+		now := time.Now()
+		if err := db.DB.Model(&link).Updates(map[string]interface{}{
+			"view_count":     gorm.Expr("view_count + 1"),
+			"last_viewed_at": now,
+		}).Error; err != nil {
+			log.Printf("Failed to count view of share link %d: %v", link.ID, err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"original_text":    entry.OriginalText,
+			"paraphrased_text": entry.ParaphrasedText,
+			"language":         entry.Language,
+			"style":            entry.Style,
+			"mode":             entry.Mode,
+			"created_at":       entry.CreatedAt,
+			"diff":             services.WordDiff(entry.OriginalText, entry.ParaphrasedText),
+			"views":            link.ViewCount + 1,
+		})
+	}
+}
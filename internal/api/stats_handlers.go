@@ -11,6 +11,9 @@ import (
 
 type StatsResponse struct {
 	TotalParaphrases  int                  `json:"totalParaphrases"`
+	Regenerations     int                  `json:"regenerations"`
+	Rewrites          int                  `json:"rewrites"`
+	ManualEdits       int                  `json:"manualEdits"`
 	LanguageBreakdown map[string]int       `json:"languageBreakdown"`
 	StyleBreakdown    map[string]int       `json:"styleBreakdown"`
 	DailyUsage        []DailyUsageResponse `json:"dailyUsage"`
@@ -25,11 +28,21 @@ func HandleGetUserStats() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _ := c.Get("userID")
 
-		// Get total paraphrases
-		var totalParaphrases int64
+		// Count fresh paraphrases separately from revisions of earlier results
+		var totals struct {
+			Fresh         int
+			Regenerations int
+			Rewrites      int
+			Edits         int
+		}
 		if err := db.DB.Model(&models.ParaphraseHistory{}).
+			Select(`COUNT(*) FILTER (WHERE parent_id IS NULL) AS fresh,
+				COUNT(*) FILTER (WHERE parent_id IS NOT NULL AND mode NOT IN (?, ?)) AS regenerations,
+				COUNT(*) FILTER (WHERE mode = ?) AS rewrites,
+				COUNT(*) FILTER (WHERE mode = ?) AS edits`,
+				models.HistoryModeRewrite, models.HistoryModeEdit, models.HistoryModeRewrite, models.HistoryModeEdit).
 			Where("user_id = ?", userID).
-			Count(&totalParaphrases).Error; err != nil {
+			Scan(&totals).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch stats"})
 			return
 		}
@@ -97,7 +110,10 @@ func HandleGetUserStats() gin.HandlerFunc {
 		}
 
 		c.JSON(http.StatusOK, StatsResponse{
-			TotalParaphrases:  int(totalParaphrases),
+			TotalParaphrases:  totals.Fresh,
+			Regenerations:     totals.Regenerations,
+			Rewrites:          totals.Rewrites,
+			ManualEdits:       totals.Edits,
 			LanguageBreakdown: languageBreakdown,
 			StyleBreakdown:    styleBreakdown,
 			DailyUsage:        dailyUsageResponse,
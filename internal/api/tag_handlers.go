@@ -0,0 +1,189 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxTagLength      = 50
+	maxTagsPerHistory = 20
+)
+
+type SetTagsRequest struct {
+	Tags []string `json:"tags" binding:"max=20"`
+}
+
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// normalizeTagName lowercases a tag and collapses its whitespace so "Blog
+// Post" and "blog  post" are the same tag.
+func normalizeTagName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// loadHistoryTags fills in the Tags of each entry.
+func loadHistoryTags(history []models.ParaphraseHistory) error {
+	if len(history) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(history))
+	for i, h := range history {
+		ids[i] = h.ID
+	}
+
+	var rows []struct {
+		HistoryID uint
+		Name      string
+	}
+	if err := db.DB.Table("history_tags").
+		Select("history_tags.history_id, tags.name").
+		Joins("JOIN tags ON tags.id = history_tags.tag_id").
+		Where("history_tags.history_id IN ?", ids).
+		Order("tags.name").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	tags := make(map[uint][]string)
+	for _, row := range rows {
+		tags[row.HistoryID] = append(tags[row.HistoryID], row.Name)
+	}
+	for i := range history {
+		history[i].Tags = tags[history[i].ID]
+	}
+	return nil
+}
+
+// HandleSetHistoryTags replaces the tags on an entry. Tags are created as
+// needed, and tags no longer on any entry are removed.
+func HandleSetHistoryTags() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var req SetTagsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var names []string
+		seen := make(map[string]bool)
+		for _, tag := range req.Tags {
+			name := normalizeTagName(tag)
+			if name == "" || seen[name] {
+				continue
+			}
+			if utf8.RuneCountInString(name) > maxTagLength {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "tags are limited to 50 characters"})
+				return
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+		if len(names) > maxTagsPerHistory {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "entries are limited to 20 tags"})
+			return
+		}
+
+		var entry models.ParaphraseHistory
+		if err := db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+			First(&entry).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "history entry not found"})
+			return
+		}
+
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("history_id = ?", entry.ID).Delete(&models.HistoryTag{}).Error; err != nil {
+				return err
+			}
+
+			for _, name := range names {
+				tag := models.Tag{UserID: entry.UserID, Name: name}
+				if err := tx.Where("user_id = ? AND name = ?", entry.UserID, name).
+					FirstOrCreate(&tag).Error; err != nil {
+					return err
+				}
+				if err := tx.Create(&models.HistoryTag{HistoryID: entry.ID, TagID: tag.ID}).Error; err != nil {
+					return err
+				}
+			}
+
+			return tx.Where("user_id = ? AND NOT EXISTS (SELECT 1 FROM history_tags WHERE history_tags.tag_id = tags.id)", entry.UserID).
+				Delete(&models.Tag{}).Error
+		})
+		if err != nil {
+			log.Printf("Error saving tags: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save tags"})
+			return
+		}
+
+		if names == nil {
+			names = []string{}
+		}
+		c.JSON(http.StatusOK, gin.H{"tags": names})
+	}
+}
+
+// HandleGetTagCloud returns the user's tags with the number of entries in
+// history carrying each, most used first.
+func HandleGetTagCloud() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var tags []TagCount
+		if err := db.DB.Table("tags").
+			Select("tags.name, COUNT(*) AS count").
+			Joins("JOIN history_tags ON history_tags.tag_id = tags.id").
+			Joins("JOIN paraphrase_histories ON paraphrase_histories.id = history_tags.history_id AND paraphrase_histories.deleted_at IS NULL").
+			Where("tags.user_id = ?", userID).
+			Group("tags.name").
+			Order("count DESC, tags.name").
+			Scan(&tags).Error; err != nil {
+			log.Printf("Error fetching tags: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch tags"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"tags": tags})
+	}
+}
+
+// HandleDeleteTag removes a tag from all of the user's entries.
+func HandleDeleteTag() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var tag models.Tag
+		if err := db.DB.Where("user_id = ? AND name = ?", userID, normalizeTagName(c.Param("name"))).
+			First(&tag).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "tag not found"})
+			return
+		}
+
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("tag_id = ?", tag.ID).Delete(&models.HistoryTag{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&tag).Error
+		})
+		if err != nil {
+			log.Printf("Error deleting tag: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete tag"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "tag deleted"})
+	}
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type BulkDeleteRequest struct {
+	IDs []uint `json:"ids" binding:"required,min=1,max=100"`
+}
+
+// TrashEntry is a deleted history entry and when it will be purged.
+type TrashEntry struct {
+	models.ParaphraseHistory
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// HandleDeleteHistory moves an entry to the trash. Deleting the first entry
+// of a revision tree deletes the whole tree with it; deleting a later
+// revision removes only that revision.
+func HandleDeleteHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var entry models.ParaphraseHistory
+		if err := db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+			First(&entry).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "history entry not found"})
+			return
+		}
+
+		// A single statement gives the tree one deleted_at, so it can be
+		// restored as a unit
+		result := db.DB.Where("user_id = ? AND (id = ? OR root_id = ?)", userID, entry.ID, entry.ID).
+			Delete(&models.ParaphraseHistory{})
+		if result.Error != nil {
+			log.Printf("Error deleting history: %v", result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete history"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"deleted": result.RowsAffected})
+	}
+}
+
+// HandleBulkDeleteHistory moves up to 100 entries to the trash, with the
+// same revision tree handling as HandleDeleteHistory. IDs that are not the
+// user's are ignored.
+func HandleBulkDeleteHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var req BulkDeleteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result := db.DB.Where("user_id = ? AND (id IN ? OR root_id IN ?)", userID, req.IDs, req.IDs).
+			Delete(&models.ParaphraseHistory{})
+		if result.Error != nil {
+			log.Printf("Error deleting history: %v", result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete history"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"deleted": result.RowsAffected})
+	}
+}
+
+// HandleGetTrash lists deleted entries that can still be restored, most
+// recently deleted first. Paged with limit and offset.
+func HandleGetTrash(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		limit, err := parsePageSize(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		offset, err := parseOffset(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		query := db.DB.Unscoped().Model(&models.ParaphraseHistory{}).
+			Where("user_id = ? AND deleted_at IS NOT NULL AND deleted_at >= ?", userID, services.TrashCutoff(cfg))
+
+		var total int64
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			log.Printf("Error counting trash: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch trash"})
+			return
+		}
+
+		var history []models.ParaphraseHistory
+		if err := query.Order("deleted_at desc, id desc").
+			Limit(limit).
+			Offset(offset).
+			Find(&history).Error; err != nil {
+			log.Printf("Error fetching trash: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch trash"})
+			return
+		}
+
+		entries := make([]TrashEntry, len(history))
+		for i, h := range history {
+			entries[i] = TrashEntry{
+				ParaphraseHistory: h,
+				DeletedAt:         h.DeletedAt.Time,
+				PurgeAt:           h.DeletedAt.Time.AddDate(0, 0, cfg.HistoryTrashRetentionDays),
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"trash": entries,
+			"total": total,
+		})
+	}
+}
+
+// HandleRestoreHistory brings an entry back from the trash. Restoring the
+// first entry of a revision tree also restores the revisions deleted with
+// it; restoring a revision also restores its tree's first entry if that is
+// in the trash, so the revision has somewhere to belong.
+func HandleRestoreHistory(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var entry models.ParaphraseHistory
+		if err := db.DB.Unscoped().
+			Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", c.Param("id"), userID).
+			First(&entry).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "history entry not found in trash"})
+			return
+		}
+
+		if entry.DeletedAt.Time.Before(services.TrashCutoff(cfg)) {
+			c.JSON(http.StatusGone, gin.H{"error": "history entry can no longer be restored"})
+			return
+		}
+
+		var restored int64
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			// Revisions deleted along with a root share its deleted_at
+			restoreTree := func(root models.ParaphraseHistory) error {
+				result := tx.Unscoped().Model(&models.ParaphraseHistory{}).
+					Where("user_id = ? AND (id = ? OR root_id = ?) AND deleted_at = ?", userID, root.ID, root.ID, root.DeletedAt.Time).
+					Update("deleted_at", nil)
+				restored += result.RowsAffected
+				return result.Error
+			}
+
+			if entry.RootID == nil {
+				return restoreTree(entry)
+			}
+
+			result := tx.Unscoped().Model(&models.ParaphraseHistory{}).
+				Where("id = ?", entry.ID).
+				Update("deleted_at", nil)
+			if result.Error != nil {
+				return result.Error
+			}
+			restored += result.RowsAffected
+
+			var root models.ParaphraseHistory
+			err := tx.Unscoped().
+				Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", *entry.RootID, userID).
+				First(&root).Error
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return restoreTree(root)
+		})
+		if err != nil {
+			log.Printf("Error restoring history: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore history"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"restored": restored})
+	}
+}
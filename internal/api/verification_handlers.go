@@ -0,0 +1,134 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errEmailTaken = errors.New("email already in use")
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// sendVerificationEmail emails userID a link confirming address, which is
+// either their current email or the one they are changing to.
+func sendVerificationEmail(cfg *config.Config, mailer services.Mailer, userID uint, address string) error {
+	token, err := services.CreateAccountToken(userID, models.TokenPurposeEmailVerification, address, services.EmailVerificationTokenTTL)
+	if err != nil {
+		return err
+	}
+	services.SendEmailAsync(mailer, services.EmailVerificationEmail(cfg, address, token))
+	return nil
+}
+
+// HandleVerifyEmail confirms the address a verification link was sent to.
+// For a pending email change this is when the new address takes effect.
+func HandleVerifyEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req VerifyEmailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user models.User
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			token, err := services.ConsumeAccountToken(tx, req.Token, models.TokenPurposeEmailVerification)
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, token.UserID).Error; err != nil {
+				return err
+			}
+
+			switch {
+			case token.Email == user.Email:
+			case token.Email == user.PendingEmail:
+				var count int64
+				if err := tx.Model(&models.User{}).
+					Where("LOWER(email) = LOWER(?) AND id <> ?", token.Email, user.ID).
+					Count(&count).Error; err != nil {
+					return err
+				}
+				if count > 0 {
+					return errEmailTaken
+				}
+				user.Email = token.Email
+				user.PendingEmail = ""
+			default:
+				// The address changed again after this link was sent
+				return services.ErrInvalidAccountToken
+			}
+
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+			return tx.Model(&user).Select("email", "pending_email", "email_verified_at").Updates(&user).Error
+		})
+		switch {
+		case err == nil:
+		case errors.Is(err, services.ErrInvalidAccountToken), errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "verification link is invalid or has expired"})
+			return
+		case errors.Is(err, errEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": "email already in use"})
+			return
+		default:
+			log.Printf("Error verifying email: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "email verified",
+			"user": gin.H{
+				"id":             user.ID,
+				"name":           user.Name,
+				"email":          user.Email,
+				"email_verified": true,
+			},
+		})
+	}
+}
+
+// HandleResendVerification sends a new link for the pending email change,
+// or for the current address if it is not yet verified.
+func HandleResendVerification(cfg *config.Config, mailer services.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var user models.User
+		if err := db.DB.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+
+		address := user.PendingEmail
+		if address == "" {
+			if user.EmailVerified() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "email is already verified"})
+				return
+			}
+			address = user.Email
+		}
+
+		if err := sendVerificationEmail(cfg, mailer, user.ID, address); err != nil {
+			log.Printf("Error sending verification email for user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send verification email"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "verification email sent"})
+	}
+}
@@ -12,10 +12,13 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uint, secret string) (string, error) {
+// GenerateToken issues an access token for the session identified by
+// sessionTokenID, which becomes the token's jti.
+func GenerateToken(userID uint, sessionTokenID string, secret string) (string, error) {
 	claims := &Claims{
 		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionTokenID,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
@@ -43,23 +46,3 @@ func ValidateToken(tokenString string, secret string) (*Claims, error) {
 
 	return nil, fmt.Errorf("invalid token")
 }
-
-func GenerateTokenPair(userID uint, secret string) (token string, refreshToken string, err error) {
-	// Access token - short lived (15 minutes)
-	token, err = GenerateToken(userID, secret)
-	if err != nil {
-		return "", "", err
-	}
-
-	// Refresh token - longer lived (7 days)
-	refreshClaims := &Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * 7)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-
-	refreshToken, err = jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString([]byte(secret))
-	return token, refreshToken, err
-}
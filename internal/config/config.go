@@ -1,24 +1,91 @@
 package config
 
 import (
+	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
-	JWTSecret           string
-	DatabaseURL         string
-	ServerPort          string
-	OpenAIKey           string
-	FrontendURL         string
-	Environment         string // 'development' or 'production'
-	PaddleVendorID      string
-	PaddlePublicKey     string
-	PaddleProPriceID    string
-	PaddleTrialPriceID  string
+	AppName            string // shown in authenticator apps and emails
+	JWTSecret          string
+	DatabaseURL        string
+	ServerPort         string
+	OpenAIKey          string
+	FrontendURL        string
+	Environment        string // 'development' or 'production'
+	PaddleVendorID     string
+	PaddlePublicKey    string
+	PaddleProPriceID   string
+	PaddleTrialPriceID string
+	AdminEmails        []string // accounts allowed to use the admin endpoints
+	APIKeyRateLimit    int      // requests per minute allowed for each API key
+	TrustedProxies     []string // proxy IPs or CIDRs whose X-Forwarded-For is believed; none by default
+
+	// An account is locked for LoginLockoutMinutes after
+	// LoginLockoutThreshold failed logins in a row; an IP is blocked after
+	// LoginIPThreshold failed logins in 15 minutes.
+	LoginLockoutThreshold int
+	LoginLockoutMinutes   int
+	LoginIPThreshold      int
+
+	// Outgoing email. MailBackend is smtp, or file for development, which
+	// writes messages to MailDir. Production requires smtp.
+	MailBackend  string
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	// OpenID Connect sign-in providers, named in OIDC_PROVIDERS. Providers
+	// send users back to OIDCRedirectURL/<name>, by default the frontend's
+	// /auth/callback/<name>.
+	OIDCProviders   []OIDCProviderConfig
+	OIDCRedirectURL string
+
+	// Meaning-preservation checks run on every paraphrase. A result that
+	// violates them is regenerated up to PreservationMaxRegenerations times.
+	PreservationMaxRegenerations int
+	PreservationMinLengthRatio   float64
+	PreservationMaxLengthRatio   float64
+	PreservationMinSentenceRatio float64
+	PreservationMinNumberRecall  float64
+	PreservationMinEntityRecall  float64
+	PreservationRequireQuotes    bool
+
+	// Master key for encrypting history text at rest, base64-encoded 32
+	// bytes. Previous master keys stay listed until cmd/reencrypt has
+	// re-wrapped every data key with the current one.
+	HistoryEncryptionKey     string
+	HistoryEncryptionOldKeys []string
+
+	// Deleted history stays in the trash, restorable, for this many days
+	// before it is purged for good.
+	HistoryTrashRetentionDays int
+
+	// Files produced by background jobs are written to JobResultDir and
+	// removed JobResultTTLHours after the job finishes.
+	JobResultDir      string
+	JobResultTTLHours int
+}
+
+// OIDCProviderConfig is read from OIDC_<NAME>_ISSUER, _CLIENT_ID,
+// _CLIENT_SECRET and the optional space-separated _SCOPES.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
 }
 
 func LoadConfig() (*Config, error) {
 	return &Config{
+		AppName:            getEnvOrDefault("APP_NAME", "FrazAI"),
 		JWTSecret:          getEnvOrDefault("JWT_SECRET", "your-default-secret"),
 		DatabaseURL:        getEnvOrDefault("DATABASE_URL", "postgresql://postgres@localhost:5432/frazai_db"),
 		ServerPort:         getEnvOrDefault("PORT", "8080"),
@@ -29,6 +96,40 @@ func LoadConfig() (*Config, error) {
 		PaddlePublicKey:    getEnvOrDefault("PADDLE_PUBLIC_KEY", ""),
 		PaddleProPriceID:   getEnvOrDefault("PADDLE_PRO_PRICE_ID", ""),
 		PaddleTrialPriceID: getEnvOrDefault("PADDLE_TRIAL_PRICE_ID", ""),
+		AdminEmails:        getEnvList("ADMIN_EMAILS"),
+		APIKeyRateLimit:    getEnvInt("API_KEY_RATE_LIMIT", 60),
+		TrustedProxies:     getEnvList("TRUSTED_PROXIES"),
+
+		LoginLockoutThreshold: getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+		LoginLockoutMinutes:   getEnvInt("LOGIN_LOCKOUT_MINUTES", 15),
+		LoginIPThreshold:      getEnvInt("LOGIN_IP_THRESHOLD", 50),
+
+		MailBackend:  getEnvOrDefault("MAIL_BACKEND", "file"),
+		MailFrom:     getEnvOrDefault("MAIL_FROM", "no-reply@localhost"),
+		MailDir:      getEnvOrDefault("MAIL_DIR", filepath.Join(os.TempDir(), "frazai-mail")),
+		SMTPHost:     getEnvOrDefault("SMTP_HOST", ""),
+		SMTPPort:     getEnvOrDefault("SMTP_PORT", "587"),
+		SMTPUsername: getEnvOrDefault("SMTP_USERNAME", ""),
+		SMTPPassword: getEnvOrDefault("SMTP_PASSWORD", ""),
+
+		OIDCProviders:   getOIDCProviders(),
+		OIDCRedirectURL: getEnvOrDefault("OIDC_REDIRECT_URL", ""),
+
+		PreservationMaxRegenerations: getEnvInt("PRESERVATION_MAX_REGENERATIONS", 2),
+		PreservationMinLengthRatio:   getEnvFloat("PRESERVATION_MIN_LENGTH_RATIO", 0.6),
+		PreservationMaxLengthRatio:   getEnvFloat("PRESERVATION_MAX_LENGTH_RATIO", 1.8),
+		PreservationMinSentenceRatio: getEnvFloat("PRESERVATION_MIN_SENTENCE_RATIO", 0.5),
+		PreservationMinNumberRecall:  getEnvFloat("PRESERVATION_MIN_NUMBER_RECALL", 1.0),
+		PreservationMinEntityRecall:  getEnvFloat("PRESERVATION_MIN_ENTITY_RECALL", 0.7),
+		PreservationRequireQuotes:    getEnvBool("PRESERVATION_REQUIRE_QUOTES", true),
+
+		HistoryEncryptionKey:     getEnvOrDefault("HISTORY_ENCRYPTION_KEY", ""),
+		HistoryEncryptionOldKeys: getEnvList("HISTORY_ENCRYPTION_OLD_KEYS"),
+
+		HistoryTrashRetentionDays: getEnvInt("HISTORY_TRASH_RETENTION_DAYS", 30),
+
+		JobResultDir:      getEnvOrDefault("JOB_RESULT_DIR", filepath.Join(os.TempDir(), "frazai-jobs")),
+		JobResultTTLHours: getEnvInt("JOB_RESULT_TTL_HOURS", 24),
 	}, nil
 }
 
@@ -38,3 +139,75 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvList splits a comma-separated variable, dropping empty items.
+func getEnvList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range getEnvList("OIDC_PROVIDERS") {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		provider := OIDCProviderConfig{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(os.Getenv(prefix+"ISSUER"), "/"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(getEnvOrDefault(prefix+"SCOPES", "openid email profile")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			log.Printf("Warning: OIDC provider %s needs %sISSUER and %sCLIENT_ID, skipping it", name, prefix, prefix)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: invalid integer for %s, using default %d", key, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Warning: invalid number for %s, using default %v", key, defaultValue)
+		return defaultValue
+	}
+	return f
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Warning: invalid boolean for %s, using default %v", key, defaultValue)
+		return defaultValue
+	}
+	return b
+}
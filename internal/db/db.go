@@ -18,6 +18,11 @@ func Initialize(dbURL string) error {
 		return err
 	}
 
+	// Accounts from before email verification are taken as verified, so
+	// they keep access to checkout. This runs once, when the column is added.
+	backfillVerified := db.Migrator().HasTable(&models.User{}) &&
+		!db.Migrator().HasColumn(&models.User{}, "email_verified_at")
+
 	// Auto migrate the schemas
 	log.Println("Running database migrations...")
 	err = db.AutoMigrate(
@@ -27,12 +32,90 @@ func Initialize(dbURL string) error {
 		&models.SubscriptionPlan{},
 		&models.UserStats{},
 		&models.DailyUsage{},
+		&models.Job{},
+		&models.UsageRecord{},
+		&models.Tag{},
+		&models.HistoryTag{},
+		&models.Folder{},
+		&models.FolderItem{},
+		&models.ShareLink{},
+		&models.SharePasswordAttempt{},
+		&models.Rating{},
+		&models.UserKey{},
+		&models.RefreshToken{},
+		&models.Session{},
+		&models.AccountToken{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
+		&models.APIKey{},
+		&models.LoginAttempt{},
+		&models.AuditEvent{},
 	)
 	if err != nil {
 		return err
 	}
 
+	// Job results used to be stored in the table; they are files now
+	if db.Migrator().HasColumn(&models.Job{}, "result") {
+		if err := db.Migrator().DropColumn(&models.Job{}, "result"); err != nil {
+			return err
+		}
+	}
+
+	if err := createIndexes(db); err != nil {
+		return err
+	}
+
+	if err := backfillUsageRecords(db); err != nil {
+		return err
+	}
+
+	if backfillVerified {
+		if err := db.Exec(`UPDATE users SET email_verified_at = NOW() WHERE email_verified_at IS NULL`).Error; err != nil {
+			return err
+		}
+	}
+
 	DB = db
 	log.Println("Database initialized successfully")
 	return nil
 }
+
+// createIndexes adds indexes that struct tags cannot express, such as
+// composite indexes with sort order or partial indexes.
+func createIndexes(db *gorm.DB) error {
+	statements := []string{
+		// History listing: keyset pagination on (created_at, id) per user,
+		// optionally filtered by language, style or favourites
+		`CREATE INDEX IF NOT EXISTS idx_history_user_created
+			ON paraphrase_histories (user_id, created_at DESC, id DESC) WHERE deleted_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_history_user_language_created
+			ON paraphrase_histories (user_id, language, created_at DESC, id DESC) WHERE deleted_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_history_user_style_created
+			ON paraphrase_histories (user_id, style, created_at DESC, id DESC) WHERE deleted_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_history_user_favorite_created
+			ON paraphrase_histories (user_id, created_at DESC, id DESC) WHERE deleted_at IS NULL AND is_favorite`,
+		// Logins look accounts up by email regardless of case
+		`CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email))`,
+		// At most one active data key per user
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_user_keys_active ON user_keys (user_id) WHERE active`,
+	}
+
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+
+	return createSearchIndex(db)
+}
+
+// backfillUsageRecords adds ledger entries for history rows created before
+// the usage ledger existed, including rows that are in the trash.
+func backfillUsageRecords(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO usage_records (user_id, mode, history_id, created_at)
+		SELECT h.user_id, COALESCE(h.mode, 'paraphrase'), h.id, h.created_at
+		FROM paraphrase_histories h
+		WHERE NOT EXISTS (SELECT 1 FROM usage_records u WHERE u.history_id = h.id)`).Error
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// searchConfigs maps history languages to Postgres text search
+// configurations. Languages without one are indexed with "simple", which
+// matches words exactly without stemming.
+var searchConfigs = map[string]string{
+	"danish":     "danish",
+	"dutch":      "dutch",
+	"english":    "english",
+	"finnish":    "finnish",
+	"french":     "french",
+	"german":     "german",
+	"hungarian":  "hungarian",
+	"italian":    "italian",
+	"norwegian":  "norwegian",
+	"portuguese": "portuguese",
+	"romanian":   "romanian",
+	"russian":    "russian",
+	"spanish":    "spanish",
+	"swedish":    "swedish",
+	"turkish":    "turkish",
+}
+
+// SearchConfig returns the text search configuration for a language.
+func SearchConfig(language string) string {
+	if config, ok := searchConfigs[strings.ToLower(strings.TrimSpace(language))]; ok {
+		return config
+	}
+	return "simple"
+}
+
+// createSearchIndex adds a generated tsvector column over the original and
+// paraphrased text, using each row's language to pick the configuration,
+// and a GIN index on it.
+func createSearchIndex(db *gorm.DB) error {
+	languages := make([]string, 0, len(searchConfigs))
+	for language := range searchConfigs {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	var cases strings.Builder
+	for _, language := range languages {
+		fmt.Fprintf(&cases, " WHEN '%s' THEN '%s'::regconfig", language, searchConfigs[language])
+	}
+
+	statements := []string{
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION history_search_config(language text) RETURNS regconfig
+			LANGUAGE sql IMMUTABLE PARALLEL SAFE AS
+			$$ SELECT CASE lower(trim(coalesce(language, '')))%s ELSE 'simple'::regconfig END $$`, cases.String()),
+		`ALTER TABLE paraphrase_histories ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (
+				setweight(to_tsvector(history_search_config(language), coalesce(paraphrased_text, '')), 'A') ||
+				setweight(to_tsvector(history_search_config(language), coalesce(original_text, '')), 'B')
+			) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_history_search_vector
+			ON paraphrase_histories USING GIN (search_vector)`,
+	}
+
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -24,6 +24,10 @@ func SeedSubscriptionPlans() error {
 				"charactersPerRequest": 1000,
 				"requestsPerDay":       5,
 				"bulkParaphrase":       false,
+				"operations": []string{
+					models.HistoryModeParaphrase,
+					models.HistoryModeGrammar,
+				},
 			})),
 		},
 		{
@@ -38,11 +42,22 @@ func SeedSubscriptionPlans() error {
 				"Paraphrase and translate at the same time",
 				"Unlimited paraphrase with AI",
 				"All paraphrasing styles",
+				"Summarize, expand, simplify and change tone",
 			})),
 			Limits: models.JSON(mustMarshal(map[string]interface{}{
 				"charactersPerRequest": 10000, // unlimited
 				"requestsPerDay":       -1,    // unlimited
 				"bulkParaphrase":       true,
+				"documentCharacters":   100000,
+				"documentSegments":     200,
+				"operations": []string{
+					models.HistoryModeParaphrase,
+					models.HistoryModeGrammar,
+					models.HistoryModeSummarize,
+					models.HistoryModeExpand,
+					models.HistoryModeSimplify,
+					models.HistoryModeChangeTone,
+				},
 			})),
 		},
 	}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminRequired allows only users whose email is listed in ADMIN_EMAILS and
+// has been verified, so that registering a listed address is not enough.
+// It must run after AuthRequired.
+func AdminRequired(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var user models.User
+		if err := db.DB.First(&user, userID).Error; err != nil || !user.EmailVerified() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+			return
+		}
+
+		for _, email := range cfg.AdminEmails {
+			if strings.EqualFold(email, user.Email) {
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+const apiKeyScheme = "ApiKey "
+
+// APIKeyOrAuthRequired is AuthRequired for routes that API keys may also
+// call. A key must carry scope, and each key is rate limited.
+func APIKeyOrAuthRequired(cfg *config.Config, limiter *services.RateLimiter, scope string) gin.HandlerFunc {
+	authRequired := AuthRequired(cfg)
+
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, apiKeyScheme) {
+			authRequired(c)
+			return
+		}
+
+		key, err := services.FindAPIKey(strings.TrimSpace(strings.TrimPrefix(header, apiKeyScheme)), c.ClientIP())
+		if err != nil {
+			log.Printf("Error checking API key: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to verify API key"})
+			return
+		}
+		if key == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+			return
+		}
+		if !key.Scopes.Has(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "API key lacks the " + scope + " scope",
+				"code":  "INSUFFICIENT_SCOPE",
+			})
+			return
+		}
+
+		allowed, remaining, reset := limiter.Allow(strconv.FormatUint(uint64(key.ID), 10))
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limiter.Limit()))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": "rate limit exceeded",
+				"code":  "RATE_LIMITED",
+			})
+			return
+		}
+
+		c.Set("userID", key.UserID)
+		c.Set("apiKeyID", key.ID)
+		c.Next()
+	}
+}
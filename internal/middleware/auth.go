@@ -1,11 +1,13 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/arrinal/paraphrase-saas/internal/auth"
 	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/services"
 	"github.com/gin-gonic/gin"
 )
 
@@ -19,12 +21,28 @@ func AuthRequired(cfg *config.Config) gin.HandlerFunc {
 
 		tokenString := strings.Replace(header, "Bearer ", "", 1)
 		claims, err := auth.ValidateToken(tokenString, cfg.JWTSecret)
-		if err != nil {
+		if err != nil || claims.ID == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
 		}
 
+		session, err := services.ActiveSession(claims.ID, c.ClientIP())
+		if err != nil {
+			log.Printf("Error checking session: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to verify session"})
+			return
+		}
+		if session == nil || session.UserID != claims.UserID {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "session has ended, please log in again",
+				"code":  "SESSION_REVOKED",
+			})
+			return
+		}
+
 		c.Set("userID", claims.UserID)
+		c.Set("sessionID", session.ID)
+		c.Set("sessionTokenID", claims.ID)
 		c.Next()
 	}
 }
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
@@ -11,37 +12,60 @@ import (
 
 func CheckSubscriptionLimits() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, _ := c.Get("userID")
+		subscription, ok := requireActiveSubscription(c)
+		if !ok {
+			return
+		}
+
+		// Parse request once and store in context
+		var req struct {
+			Text        string   `json:"text" binding:"required"`
+			Language    string   `json:"language" binding:"required"`
+			Style       string   `json:"style" binding:"required"`
+			TargetGrade *float64 `json:"target_grade" binding:"omitempty,min=1,max=18"`
+			ParentID    *uint    `json:"parent_id"`
+		}
 
-		// Check subscription status
-		var subscription models.Subscription
-		if err := db.DB.Where("user_id = ? AND status = ?", userID, "active").
-			First(&subscription).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "active subscription required"})
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
 
-		// Only check period end for pro subscriptions
-		if subscription.PlanID == "pro" && subscription.CurrentPeriodEnd.Before(time.Now()) {
-			// Update subscription status to expired
-			subscription.Status = "expired"
-			if err := db.DB.Save(&subscription).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update subscription status"})
-				c.Abort()
+		// Store parsed request in context for handler to use
+		c.Set("parsedRequest", req)
+
+		if !requireOperation(c, subscription, models.HistoryModeParaphrase) {
+			return
+		}
+
+		// Trial plan restrictions - check plan_id instead of status
+		if subscription.PlanID == "trial" {
+			if !checkTrialStyle(c, req.Style) {
 				return
 			}
 
-			c.JSON(http.StatusForbidden, gin.H{"error": "subscription has expired"})
-			c.Abort()
+			if !checkTrialRestrictions(c, subscription, req.Text, req.Language) {
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// CheckGrammarLimits validates a grammar correction request and applies the
+// same trial restrictions as paraphrasing, apart from style.
+func CheckGrammarLimits() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subscription, ok := requireActiveSubscription(c)
+		if !ok {
 			return
 		}
 
-		// Parse request once and store in context
 		var req struct {
 			Text     string `json:"text" binding:"required"`
 			Language string `json:"language" binding:"required"`
-			Style    string `json:"style" binding:"required"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -50,54 +74,140 @@ func CheckSubscriptionLimits() gin.HandlerFunc {
 			return
 		}
 
-		// Store parsed request in context for handler to use
 		c.Set("parsedRequest", req)
 
-		// Trial plan restrictions - check plan_id instead of status
+		if !requireOperation(c, subscription, models.HistoryModeGrammar) {
+			return
+		}
+
+		if subscription.PlanID == "trial" && !checkTrialRestrictions(c, subscription, req.Text, req.Language) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// CheckOperationLimits validates a text operation request and checks that
+// the user's plan allows the operation.
+func CheckOperationLimits() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subscription, ok := requireActiveSubscription(c)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Operation    string   `json:"operation" binding:"required,oneof=paraphrase summarize expand simplify change_tone"`
+			Text         string   `json:"text" binding:"required"`
+			Language     string   `json:"language" binding:"required"`
+			Style        string   `json:"style"`
+			Tone         string   `json:"tone" binding:"omitempty,oneof=formal casual friendly confident empathetic persuasive neutral"`
+			TargetLength int      `json:"target_length" binding:"omitempty,min=10,max=2000"`
+			TargetGrade  *float64 `json:"target_grade" binding:"omitempty,min=1,max=18"`
+			ParentID     *uint    `json:"parent_id"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		if req.Operation == models.HistoryModeParaphrase && req.Style == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "style is required for paraphrase"})
+			c.Abort()
+			return
+		}
+		if req.Operation == models.HistoryModeChangeTone && req.Tone == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tone is required for change_tone"})
+			c.Abort()
+			return
+		}
+
+		c.Set("parsedRequest", req)
+
+		if !requireOperation(c, subscription, req.Operation) {
+			return
+		}
+
 		if subscription.PlanID == "trial" {
-			// Enforce English only
-			if req.Language != "English" && req.Language != "english" {
-				c.JSON(http.StatusForbidden, gin.H{
-					"error": "trial plan only supports English language",
-					"code":  "TRIAL_RESTRICTION",
-				})
-				c.Abort()
+			if req.Operation == models.HistoryModeParaphrase && !checkTrialStyle(c, req.Style) {
 				return
 			}
 
-			// Enforce standard style only
-			if req.Style != "standard" {
-				c.JSON(http.StatusForbidden, gin.H{
-					"error": "trial plan only supports standard style",
-					"code":  "TRIAL_RESTRICTION",
-				})
-				c.Abort()
+			if !checkTrialRestrictions(c, subscription, req.Text, req.Language) {
 				return
 			}
+		}
 
-			// Check character limit
-			if len(req.Text) > 1000 {
-				c.JSON(http.StatusForbidden, gin.H{
-					"error": "trial plan limited to 1000 characters",
-					"code":  "TRIAL_RESTRICTION",
-				})
-				c.Abort()
+		c.Next()
+	}
+}
+
+// Partial rewrites don't use up the trial quota but are capped separately
+const trialRewriteLimit = 10
+
+// CheckRewriteLimits validates a partial rewrite request, requires an
+// active subscription and caps how many rewrites a trial account can make.
+// Trial rewrites are held to the standard style like full paraphrases,
+// whether the style is asked for or inherited from the entry.
+func CheckRewriteLimits() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subscription, ok := requireActiveSubscription(c)
+		if !ok {
+			return
+		}
+
+		// The part of a result to regenerate, either by sentence index or by
+		// character range [start, end)
+		var req struct {
+			SentenceIndex *int   `json:"sentence_index" binding:"omitempty,min=0"`
+			Start         *int   `json:"start" binding:"omitempty,min=0"`
+			End           *int   `json:"end" binding:"omitempty,min=0"`
+			Style         string `json:"style"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Set("parsedRequest", req)
+
+		if subscription.PlanID == "trial" {
+			style := req.Style
+			if style == "" {
+				// A missing entry is left for the handler to report
+				var styles []string
+				if err := db.DB.Model(&models.ParaphraseHistory{}).
+					Where("id = ? AND user_id = ?", c.Param("id"), subscription.UserID).
+					Pluck("style", &styles).Error; err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load history entry"})
+					c.Abort()
+					return
+				}
+				if len(styles) > 0 {
+					style = styles[0]
+				}
+			}
+			if style != "" && !checkTrialStyle(c, style) {
 				return
 			}
 
-			// Check total usage limit for trial account
-			var totalUsageCount int64
-			if err := db.DB.Model(&models.ParaphraseHistory{}).
-				Where("user_id = ?", userID).
-				Count(&totalUsageCount).Error; err != nil {
+			var rewriteCount int64
+			if err := db.DB.Model(&models.UsageRecord{}).
+				Where("user_id = ? AND mode = ?", subscription.UserID, models.HistoryModeRewrite).
+				Count(&rewriteCount).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check usage limit"})
 				c.Abort()
 				return
 			}
 
-			if totalUsageCount >= 5 {
+			if rewriteCount >= trialRewriteLimit {
 				c.JSON(http.StatusForbidden, gin.H{
-					"error": "trial plan limited to 5 paraphrases total",
+					"error": fmt.Sprintf("trial plan limited to %d sentence rewrites", trialRewriteLimit),
 					"code":  "TRIAL_RESTRICTION",
 				})
 				c.Abort()
@@ -108,3 +218,165 @@ func CheckSubscriptionLimits() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// CheckDocumentLimits allows document uploads only on plans with bulk
+// paraphrasing enabled. The plan's limits are stored in the context so the
+// handler can check the size of the parsed document.
+func CheckDocumentLimits() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subscription, ok := requireActiveSubscription(c)
+		if !ok {
+			return
+		}
+
+		limits, ok := loadPlanLimits(c, subscription)
+		if !ok {
+			return
+		}
+
+		if !limits.BulkParaphrase {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "document paraphrasing is not available on your plan",
+				"code":  "PLAN_RESTRICTION",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("planLimits", limits)
+		c.Next()
+	}
+}
+
+// requireActiveSubscription loads the user's active subscription, expiring it
+// if its period has ended. It aborts the request and returns false if there
+// is no usable subscription.
+func requireActiveSubscription(c *gin.Context) (*models.Subscription, bool) {
+	userID, _ := c.Get("userID")
+
+	// Check subscription status
+	var subscription models.Subscription
+	if err := db.DB.Where("user_id = ? AND status = ?", userID, "active").
+		First(&subscription).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "active subscription required"})
+		c.Abort()
+		return nil, false
+	}
+
+	// Only check period end for pro subscriptions
+	if subscription.PlanID == "pro" && subscription.CurrentPeriodEnd.Before(time.Now()) {
+		// Update subscription status to expired
+		subscription.Status = "expired"
+		if err := db.DB.Save(&subscription).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update subscription status"})
+			c.Abort()
+			return nil, false
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "subscription has expired"})
+		c.Abort()
+		return nil, false
+	}
+
+	return &subscription, true
+}
+
+// checkTrialStyle aborts the request unless style is the standard style,
+// the only one the trial plan supports.
+func checkTrialStyle(c *gin.Context, style string) bool {
+	if style != "standard" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "trial plan only supports standard style",
+			"code":  "TRIAL_RESTRICTION",
+		})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// checkTrialRestrictions enforces the trial plan's language, length and total
+// usage limits. It aborts the request and returns false if one is exceeded.
+func checkTrialRestrictions(c *gin.Context, subscription *models.Subscription, text, language string) bool {
+	// Enforce English only
+	if language != "English" && language != "english" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "trial plan only supports English language",
+			"code":  "TRIAL_RESTRICTION",
+		})
+		c.Abort()
+		return false
+	}
+
+	// Check character limit
+	if len(text) > 1000 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "trial plan limited to 1000 characters",
+			"code":  "TRIAL_RESTRICTION",
+		})
+		c.Abort()
+		return false
+	}
+
+	// Check total usage limit for trial account. Partial rewrites and manual
+	// edits of an existing result are not full paraphrases and don't count.
+	// Usage comes from the ledger, so deleting history doesn't free quota.
+	var totalUsageCount int64
+	if err := db.DB.Model(&models.UsageRecord{}).
+		Where("user_id = ? AND mode NOT IN (?)", subscription.UserID, []string{models.HistoryModeRewrite, models.HistoryModeEdit}).
+		Count(&totalUsageCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check usage limit"})
+		c.Abort()
+		return false
+	}
+
+	if totalUsageCount >= 5 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "trial plan limited to 5 paraphrases total",
+			"code":  "TRIAL_RESTRICTION",
+		})
+		c.Abort()
+		return false
+	}
+
+	return true
+}
+
+// loadPlanLimits loads the limits of the subscription's plan. It aborts the
+// request and returns false if they cannot be read.
+func loadPlanLimits(c *gin.Context, subscription *models.Subscription) (models.PlanLimits, bool) {
+	var plan models.SubscriptionPlan
+	if err := db.DB.First(&plan, "id = ?", subscription.PlanID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load subscription plan"})
+		c.Abort()
+		return models.PlanLimits{}, false
+	}
+
+	limits, err := plan.ParsedLimits()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load plan limits"})
+		c.Abort()
+		return models.PlanLimits{}, false
+	}
+
+	return limits, true
+}
+
+// requireOperation aborts the request unless the plan allows operation.
+func requireOperation(c *gin.Context, subscription *models.Subscription, operation string) bool {
+	limits, ok := loadPlanLimits(c, subscription)
+	if !ok {
+		return false
+	}
+
+	if !limits.AllowsOperation(operation) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": fmt.Sprintf("%s is not available on your plan", operation),
+			"code":  "PLAN_RESTRICTION",
+		})
+		c.Abort()
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// EmailVerifiedRequired allows only users who have confirmed their email
+// address. It must run after AuthRequired.
+func EmailVerifiedRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+
+		var user models.User
+		if err := db.DB.Select("id", "email_verified_at").First(&user, userID).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+			return
+		}
+
+		if !user.EmailVerified() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "please verify your email address first",
+				"code":  "EMAIL_NOT_VERIFIED",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Account token purposes
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeMFAChallenge      = "mfa_challenge"
+	TokenPurposeAccountUnlock     = "account_unlock"
+)
+
+// AccountToken is a single-use token proving a step of an account flow,
+// such as receiving an emailed link or passing the password check before
+// a second factor. Only the token's hash is stored.
+type AccountToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index"`
+	Purpose   string    `gorm:"index;not null"`
+	Email     string    // address the token was sent to
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+	Attempts  int // failed attempts to complete the flow with it
+	CreatedAt time.Time
+}
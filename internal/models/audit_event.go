@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Audit events
+const (
+	AuditLoginLockout   = "login.lockout"
+	AuditLoginIPBlocked = "login.ip_blocked"
+	AuditAccountUnlock  = "login.unlock"
+	AuditShareLockout   = "share.lockout"
+)
+
+// AuditEvent records a security-relevant event for later review.
+type AuditEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Event     string    `gorm:"index;not null" json:"event"`
+	UserID    *uint     `gorm:"index" json:"user_id,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TextCipher encrypts history text at rest with a per-user key.
+type TextCipher interface {
+	Encrypt(userID uint, plaintext string) (string, error)
+	Decrypt(userID uint, ciphertext string) (string, error)
+}
+
+// HistoryCipher is set at startup when a master key is configured. Without
+// it encryption cannot be turned on and encrypted history cannot be read.
+var HistoryCipher TextCipher
+
+// UserKey is a user's data key, wrapped (encrypted) by a master key. Only
+// the active key encrypts new text; older keys stay until everything they
+// encrypted has been re-encrypted.
+type UserKey struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"index" json:"user_id"`
+	WrappedKey  []byte    `gorm:"type:bytea;not null" json:"-"`
+	MasterKeyID string    `gorm:"index" json:"master_key_id"` // fingerprint of the wrapping master key
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// EncryptText replaces the entry's text, including the text quoted in
+// grammar edits, with ciphertext.
+func (h *ParaphraseHistory) EncryptText() error {
+	if HistoryCipher == nil {
+		return fmt.Errorf("history encryption is not configured")
+	}
+	if err := h.transformText(func(s string) (string, error) {
+		return HistoryCipher.Encrypt(h.UserID, s)
+	}); err != nil {
+		return err
+	}
+	h.Encrypted = true
+	return nil
+}
+
+// DecryptText turns the entry's text back into plain text.
+func (h *ParaphraseHistory) DecryptText() error {
+	if HistoryCipher == nil {
+		return fmt.Errorf("history encryption is not configured")
+	}
+	if err := h.transformText(func(s string) (string, error) {
+		return HistoryCipher.Decrypt(h.UserID, s)
+	}); err != nil {
+		return err
+	}
+	h.Encrypted = false
+	return nil
+}
+
+func (h *ParaphraseHistory) transformText(fn func(string) (string, error)) error {
+	// Edits may share their array with the caller's copy
+	if h.Edits != nil {
+		h.Edits = append(TextEdits(nil), h.Edits...)
+	}
+
+	fields := []*string{&h.OriginalText, &h.ParaphrasedText}
+	for i := range h.Edits {
+		fields = append(fields, &h.Edits[i].Original, &h.Edits[i].Replacement, &h.Edits[i].Explanation)
+	}
+
+	for _, field := range fields {
+		if *field == "" {
+			continue
+		}
+		value, err := fn(*field)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+	return nil
+}
+
+// AfterFind decrypts encrypted entries as they are loaded.
+func (h *ParaphraseHistory) AfterFind(tx *gorm.DB) error {
+	if !h.Encrypted {
+		return nil
+	}
+	return h.DecryptText()
+}
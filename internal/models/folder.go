@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Folder is a named collection of history entries. An entry can be in any
+// number of folders; deleting a folder leaves its entries in history.
+type Folder struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_folder_user_name" json:"user_id"`
+	Name      string    `gorm:"uniqueIndex:idx_folder_user_name" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FolderItem places a history entry in a folder.
+type FolderItem struct {
+	FolderID  uint      `gorm:"primaryKey" json:"folder_id"`
+	HistoryID uint      `gorm:"primaryKey;index" json:"history_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to their account at an OpenID Connect
+// provider. A user may have one per provider account.
+type UserIdentity struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"index" json:"-"`
+	Provider    string     `gorm:"uniqueIndex:idx_identity_provider_subject;not null" json:"provider"`
+	Subject     string     `gorm:"uniqueIndex:idx_identity_provider_subject;not null" json:"-"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// OIDCLoginState remembers a sign-in started with a provider until the
+// user comes back from it. Only the hashes of the state parameter and of
+// the binding value, which the browser that started the sign-in keeps,
+// are stored.
+type OIDCLoginState struct {
+	ID           uint   `gorm:"primaryKey"`
+	StateHash    string `gorm:"uniqueIndex;not null"`
+	BindingHash  string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	LinkUserID   *uint     // set when a signed-in user is linking the provider
+	ExpiresAt    time.Time `gorm:"index"`
+	CreatedAt    time.Time
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+)
+
+// Job is a unit of background work owned by a user, such as a document
+// paraphrase. Jobs that produce a file keep it at ResultPath until
+// ResultExpiresAt, when the file is removed.
+type Job struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"index" json:"user_id"`
+	Kind        string     `gorm:"index" json:"kind"`
+	Status      string     `gorm:"index" json:"status"`
+	Progress    int        `json:"progress"`
+	Error       string     `json:"error,omitempty"`
+	FileName    string     `json:"file_name,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	ResultPath  string     `json:"-"`
+	HistoryID   *uint      `json:"history_id,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	ResultExpiresAt *time.Time `gorm:"index" json:"result_expires_at,omitempty"`
+}
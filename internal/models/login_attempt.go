@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// LoginAttempt records one password login, for throttling. Email is
+// lowercased and recorded whether or not an account uses it, so throttling
+// behaves the same for unknown addresses. A success, or an unlock from
+// the emailed link, resets the failure count for the email.
+type LoginAttempt struct {
+	ID        uint      `gorm:"primaryKey"`
+	Email     string    `gorm:"index;not null"`
+	IP        string    `gorm:"index"`
+	UserID    *uint     `gorm:"index"`
+	Succeeded bool      `gorm:"default:false"`
+	CreatedAt time.Time `gorm:"index"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// TextReadability holds readability statistics for a single text.
+type TextReadability struct {
+	Words              int     `json:"words"`
+	Sentences          int     `json:"sentences"`
+	Syllables          int     `json:"syllables"`
+	FleschReadingEase  float64 `json:"flesch_reading_ease"`
+	FleschKincaidGrade float64 `json:"flesch_kincaid_grade"`
+	AvgSentenceLength  float64 `json:"avg_sentence_length"`
+	LexicalDiversity   float64 `json:"lexical_diversity"`
+}
+
+// QualityMetrics compares the readability of an original text and its
+// paraphrase. It is stored as JSONB on the history row.
+type QualityMetrics struct {
+	Original            TextReadability `json:"original"`
+	Paraphrased         TextReadability `json:"paraphrased"`
+	Similarity          float64         `json:"similarity"`
+	TargetGrade         *float64        `json:"target_grade,omitempty"`
+	StyleExpectationMet *bool           `json:"style_expectation_met,omitempty"`
+	Notes               []string        `json:"notes,omitempty"`
+}
+
+// Value implements the driver.Valuer interface.
+func (m QualityMetrics) Value() (driver.Value, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (m *QualityMetrics) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	}
+	return fmt.Errorf("unsupported type for QualityMetrics: %T", value)
+}
@@ -2,17 +2,117 @@ package models
 
 import (
 	"time"
+	"unicode/utf8"
 
 	"gorm.io/gorm"
 )
 
+// History modes are the text operations that can produce a history row.
+const (
+	HistoryModeParaphrase = "paraphrase"
+	HistoryModeGrammar    = "grammar"
+	HistoryModeSummarize  = "summarize"
+	HistoryModeExpand     = "expand"
+	HistoryModeSimplify   = "simplify"
+	HistoryModeChangeTone = "change_tone"
+	HistoryModeRewrite    = "rewrite"
+	HistoryModeEdit       = "edit"
+)
+
+// ParaphraseHistory is one result. Regenerations, partial rewrites and manual
+// edits of a result are stored as new rows with ParentID pointing at the row
+// they were derived from and RootID at the first row of the tree. Revision
+// numbers the rows of a tree in creation order, starting at 1.
 type ParaphraseHistory struct {
-	ID              uint           `gorm:"primaryKey" json:"id"`
-	UserID          uint           `gorm:"index" json:"user_id"`
-	OriginalText    string         `gorm:"type:text" json:"original_text"`
-	ParaphrasedText string         `gorm:"type:text" json:"paraphrased_text"`
-	Language        string         `json:"language"`
-	Style           string         `json:"style"`
-	CreatedAt       time.Time      `json:"created_at"`
-	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+	ID              uint            `gorm:"primaryKey" json:"id"`
+	UserID          uint            `gorm:"index" json:"user_id"`
+	ParentID        *uint           `gorm:"index" json:"parent_id,omitempty"`
+	RootID          *uint           `gorm:"index" json:"root_id,omitempty"`
+	Revision        int             `gorm:"default:1" json:"revision"`
+	OriginalText    string          `gorm:"type:text" json:"original_text"`
+	ParaphrasedText string          `gorm:"type:text" json:"paraphrased_text"`
+	Language        string          `json:"language"`
+	Style           string          `json:"style"` // paraphrase style, or target tone for change_tone
+	Mode            string          `gorm:"index;default:paraphrase" json:"mode"`
+	Model           string          `json:"model,omitempty"` // empty for manual edits
+	PromptVersion   string          `json:"prompt_version,omitempty"`
+	Edits           TextEdits       `gorm:"type:jsonb" json:"edits,omitempty"`
+	TargetLength    int             `json:"target_length,omitempty"`
+	Metrics         *QualityMetrics `gorm:"type:jsonb" json:"metrics,omitempty"`
+	Flagged         bool            `gorm:"index" json:"flagged"`
+	IsFavorite      bool            `gorm:"default:false" json:"is_favorite"`
+	OriginalLength  int             `json:"original_length"` // in characters
+	ResultLength    int             `json:"result_length"`
+	TokensUsed      int             `json:"tokens_used"`
+	Redacted        bool            `gorm:"default:false" json:"redacted"` // text removed by the retention setting
+	Encrypted       bool            `gorm:"default:false" json:"-"`        // text fields hold ciphertext
+	Tags            []string        `gorm:"-" json:"tags,omitempty"`       // filled in by list endpoints
+	CreatedAt       time.Time       `json:"created_at"`
+	DeletedAt       gorm.DeletedAt  `gorm:"index" json:"-"`
+
+	// Requests is how many model requests the entry took, when a document
+	// was paraphrased in segments; it is counted in the usage ledger
+	Requests int `gorm:"-" json:"-"`
+
+	// plain keeps the text of an entry encrypted on insert, so the caller's
+	// copy reads as plain text again once it is saved
+	plain *historyText
+}
+
+type historyText struct {
+	original    string
+	paraphrased string
+	edits       TextEdits
+}
+
+// BeforeCreate records the text lengths, then drops the text if the user
+// has chosen not to have it stored, or encrypts it if they have turned on
+// encryption.
+func (h *ParaphraseHistory) BeforeCreate(tx *gorm.DB) error {
+	h.OriginalLength = utf8.RuneCountInString(h.OriginalText)
+	h.ResultLength = utf8.RuneCountInString(h.ParaphrasedText)
+
+	var user User
+	if err := tx.Select("history_retention", "encrypt_history").
+		Where("id = ?", h.UserID).
+		Limit(1).
+		Find(&user).Error; err != nil {
+		return err
+	}
+
+	if user.HistoryRetention == RetentionNone {
+		h.Redact()
+		return nil
+	}
+
+	if user.EncryptHistory {
+		h.plain = &historyText{
+			original:    h.OriginalText,
+			paraphrased: h.ParaphrasedText,
+			edits:       h.Edits,
+		}
+		return h.EncryptText()
+	}
+	return nil
+}
+
+// AfterCreate restores the plain text of an entry encrypted on insert and
+// records the entry in the usage ledger.
+func (h *ParaphraseHistory) AfterCreate(tx *gorm.DB) error {
+	if h.plain != nil {
+		h.OriginalText = h.plain.original
+		h.ParaphrasedText = h.plain.paraphrased
+		h.Edits = h.plain.edits
+		h.Encrypted = false
+		h.plain = nil
+	}
+	return recordUsage(tx, h)
+}
+
+// Redact removes all user text from the entry, keeping its metadata.
+func (h *ParaphraseHistory) Redact() {
+	h.OriginalText = ""
+	h.ParaphrasedText = ""
+	h.Edits = nil
+	h.Redacted = true
 }
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// Reasons a user can give for a rating
+const (
+	RatingReasonMeaningChanged = "meaning_changed"
+	RatingReasonTooSimilar     = "too_similar"
+	RatingReasonWrongLanguage  = "wrong_language"
+	RatingReasonOther          = "other"
+)
+
+// Rating is a user's thumbs up or down on a history entry. Each user has at
+// most one rating per entry; rating again replaces it.
+type Rating struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_rating_user_history" json:"user_id"`
+	HistoryID uint      `gorm:"uniqueIndex:idx_rating_user_history;index" json:"history_id"`
+	Value     string    `gorm:"index" json:"value"`
+	Reason    string    `json:"reason,omitempty"`
+	Comment   string    `gorm:"type:text" json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
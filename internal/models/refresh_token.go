@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// RefreshToken is one link in a chain of rotated refresh tokens. Every
+// token descended from the same login belongs to its session, so
+// presenting a token that was already used can revoke the whole chain.
+// Only the token's hash is stored.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	SessionID uint       `gorm:"index" json:"-"`
+	TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"index" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Session is one login on one device. Its access tokens carry TokenID as
+// their jti and its refresh tokens point at it, so revoking the session
+// ends both.
+type Session struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index" json:"-"`
+	TokenID    string     `gorm:"uniqueIndex;not null" json:"-"`
+	Device     string     `json:"device"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
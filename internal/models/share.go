@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// ShareLink gives read-only public access to one history entry. Only the
+// token's hash is stored; the token itself is shown once, when the link is
+// created.
+type ShareLink struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"index" json:"user_id"`
+	HistoryID    uint       `gorm:"index" json:"history_id"`
+	TokenHash    string     `gorm:"uniqueIndex;not null" json:"-"`
+	PasswordHash string     `json:"-"`
+	HasPassword  bool       `json:"has_password"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	ViewCount    int        `gorm:"default:0" json:"view_count"`
+	LastViewedAt *time.Time `json:"last_viewed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Active reports whether the link can currently be viewed.
+func (s *ShareLink) Active() bool {
+	return s.RevokedAt == nil && (s.ExpiresAt == nil || s.ExpiresAt.After(time.Now()))
+}
+
+// SharePasswordAttempt records a wrong password given for a share link, for
+// throttling guesses per link and per IP.
+type SharePasswordAttempt struct {
+	ID          uint      `gorm:"primaryKey"`
+	ShareLinkID uint      `gorm:"index;not null"`
+	IP          string    `gorm:"index"`
+	CreatedAt   time.Time `gorm:"index"`
+}
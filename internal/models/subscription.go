@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -31,3 +32,59 @@ type SubscriptionPlan struct {
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
+
+// PlanLimits is the typed form of SubscriptionPlan.Limits.
+type PlanLimits struct {
+	CharactersPerRequest int      `json:"charactersPerRequest"`
+	RequestsPerDay       int      `json:"requestsPerDay"`
+	BulkParaphrase       bool     `json:"bulkParaphrase"`
+	Operations           []string `json:"operations"`
+	DocumentCharacters   int      `json:"documentCharacters"`
+	DocumentSegments     int      `json:"documentSegments"`
+}
+
+// Document limits for plans that don't set their own
+const (
+	defaultDocumentCharacters = 100000
+	defaultDocumentSegments   = 200
+)
+
+// MaxDocumentCharacters is the most text one uploaded document may contain.
+func (l PlanLimits) MaxDocumentCharacters() int {
+	if l.DocumentCharacters > 0 {
+		return l.DocumentCharacters
+	}
+	return defaultDocumentCharacters
+}
+
+// MaxDocumentSegments is the most segments, and so paraphrase calls, one
+// uploaded document may be split into.
+func (l PlanLimits) MaxDocumentSegments() int {
+	if l.DocumentSegments > 0 {
+		return l.DocumentSegments
+	}
+	return defaultDocumentSegments
+}
+
+// AllowsOperation reports whether the plan permits a text operation. Plans
+// that predate operations only allow paraphrasing.
+func (l PlanLimits) AllowsOperation(operation string) bool {
+	if len(l.Operations) == 0 {
+		return operation == HistoryModeParaphrase
+	}
+	for _, op := range l.Operations {
+		if op == operation {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *SubscriptionPlan) ParsedLimits() (PlanLimits, error) {
+	var limits PlanLimits
+	if len(p.Limits) == 0 {
+		return limits, nil
+	}
+	err := json.Unmarshal(p.Limits, &limits)
+	return limits, err
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Tag is a free-form label a user attaches to history entries. Names are
+// stored normalised and are unique per user.
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_tag_user_name" json:"user_id"`
+	Name      string    `gorm:"uniqueIndex:idx_tag_user_name" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HistoryTag attaches a tag to a history entry.
+type HistoryTag struct {
+	HistoryID uint      `gorm:"primaryKey" json:"history_id"`
+	TagID     uint      `gorm:"primaryKey;index" json:"tag_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
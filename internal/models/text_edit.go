@@ -0,0 +1,54 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	EditCategoryGrammar     = "grammar"
+	EditCategorySpelling    = "spelling"
+	EditCategoryPunctuation = "punctuation"
+	EditCategoryOther       = "other"
+)
+
+// TextEdit is a single suggested change to a text. Start and End are
+// character (rune) offsets into the original text.
+type TextEdit struct {
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Original    string `json:"original"`
+	Replacement string `json:"replacement"`
+	Category    string `json:"category"`
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// TextEdits is stored as JSONB.
+type TextEdits []TextEdit
+
+// Value implements the driver.Valuer interface.
+func (e TextEdits) Value() (driver.Value, error) {
+	if e == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (e *TextEdits) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*e = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, e)
+	case string:
+		return json.Unmarshal([]byte(v), e)
+	}
+	return fmt.Errorf("unsupported type for TextEdits: %T", value)
+}
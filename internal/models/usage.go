@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UsageRecord is an append-only ledger entry written for every history row
+// created. Quotas are counted here rather than on ParaphraseHistory so that
+// deleting history does not give usage back. Requests is the number of
+// model requests behind the row, one except for documents.
+type UsageRecord struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index:idx_usage_user_mode" json:"user_id"`
+	Mode      string    `gorm:"index:idx_usage_user_mode" json:"mode"`
+	HistoryID uint      `gorm:"uniqueIndex" json:"history_id"`
+	Requests  int       `gorm:"not null;default:1" json:"requests"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// recordUsage adds h to the usage ledger in the transaction that inserted
+// it.
+func recordUsage(tx *gorm.DB, h *ParaphraseHistory) error {
+	mode := h.Mode
+	if mode == "" {
+		mode = HistoryModeParaphrase
+	}
+	requests := h.Requests
+	if requests < 1 {
+		requests = 1
+	}
+	return tx.Create(&UsageRecord{
+		UserID:    h.UserID,
+		Mode:      mode,
+		HistoryID: h.ID,
+		Requests:  requests,
+		CreatedAt: h.CreatedAt,
+	}).Error
+}
@@ -6,6 +6,13 @@ import (
 	"gorm.io/gorm"
 )
 
+// History retention settings
+const (
+	RetentionForever = "forever"
+	RetentionDays    = "days"
+	RetentionNone    = "none"
+)
+
 type User struct {
 	ID        uint   `gorm:"primaryKey"`
 	Email     string `gorm:"uniqueIndex;not null"`
@@ -14,4 +21,40 @@ type User struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	// NoPassword marks accounts created through a sign-in provider, whose
+	// random password nobody knows, until the user sets one
+	NoPassword bool
+
+	// EmailVerifiedAt is set once the user confirms Email. A new address
+	// waits in PendingEmail until it is confirmed.
+	EmailVerifiedAt *time.Time
+	PendingEmail    string
+
+	// TOTPSecret is set while two-factor authentication is on; during
+	// enrolment the new secret waits in TOTPPendingSecret. TOTPLastStep is
+	// the time step of the last accepted code, so a code works only once.
+	TOTPSecret        string
+	TOTPPendingSecret string
+	TOTPEnabledAt     *time.Time
+	TOTPLastStep      int64
+
+	// HistoryRetention is forever, days (keep HistoryRetentionDays days) or
+	// none (never store text, only metadata)
+	HistoryRetention     string `gorm:"default:forever"`
+	HistoryRetentionDays int
+
+	// EncryptHistory stores the user's history text encrypted. Full-text
+	// search is unavailable while it is on.
+	EncryptHistory bool `gorm:"default:false"`
+}
+
+// EmailVerified reports whether the user has confirmed their address.
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// MFAEnabled reports whether logging in needs a second factor.
+func (u *User) MFAEnabled() bool {
+	return u.TOTPEnabledAt != nil
 }
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/config"
+)
+
+func PasswordResetEmail(cfg *config.Config, to, token string) Email {
+	link := cfg.FrontendURL + "/reset-password?token=" + url.QueryEscape(token)
+	return Email{
+		To:      to,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(`Someone asked to reset the password for your account.
+
+To choose a new password, open this link within the next hour:
+
+%s
+
+If this wasn't you, you can ignore this email; your password has not been changed.
+`, link),
+	}
+}
+
+func EmailVerificationEmail(cfg *config.Config, to, token string) Email {
+	link := cfg.FrontendURL + "/verify-email?token=" + url.QueryEscape(token)
+	return Email{
+		To:      to,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf(`Please confirm that this is your email address by opening this link within the next 48 hours:
+
+%s
+
+If you didn't create an account or change your email address, you can ignore this email.
+`, link),
+	}
+}
+
+func AccountUnlockEmail(cfg *config.Config, to, token string, lockout time.Duration) Email {
+	link := cfg.FrontendURL + "/unlock-account?token=" + url.QueryEscape(token)
+	return Email{
+		To:      to,
+		Subject: "Your account has been locked",
+		Body: fmt.Sprintf(`There were too many failed attempts to sign in to your account, so sign-in is locked for %d minutes.
+
+If this was you, you can unlock your account straight away with this link:
+
+%s
+
+If it wasn't you, someone may be trying to guess your password. Your account is safe, but consider choosing a stronger password.
+`, int(lockout.Minutes()), link),
+	}
+}
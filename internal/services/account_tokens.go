@@ -0,0 +1,92 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/auth"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PasswordResetTokenTTL     = time.Hour
+	EmailVerificationTokenTTL = 48 * time.Hour
+)
+
+var ErrInvalidAccountToken = errors.New("invalid or expired token")
+
+// CreateAccountToken issues a token for purpose, to be sent to email. Any
+// earlier unused ones are cancelled so only the latest email works.
+func CreateAccountToken(userID uint, purpose, email string, ttl time.Duration) (string, error) {
+	token, err := auth.RandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.AccountToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.AccountToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			Email:     email,
+			TokenHash: auth.HashToken(token),
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeAccountToken spends a token issued for purpose within tx. It
+// returns ErrInvalidAccountToken if the token is unknown, used or
+// expired.
+func ConsumeAccountToken(tx *gorm.DB, token, purpose string) (*models.AccountToken, error) {
+	stored, err := LockAccountToken(tx, token, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(stored).Update("used_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// LockAccountToken finds a usable token issued for purpose and locks it
+// for the rest of tx, without spending it.
+func LockAccountToken(tx *gorm.DB, token, purpose string) (*models.AccountToken, error) {
+	return findAccountToken(tx.Clauses(clause.Locking{Strength: "UPDATE"}), token, purpose)
+}
+
+// FindAccountToken finds a usable token issued for purpose without locking
+// or spending it.
+func FindAccountToken(token, purpose string) (*models.AccountToken, error) {
+	return findAccountToken(db.DB, token, purpose)
+}
+
+func findAccountToken(query *gorm.DB, token, purpose string) (*models.AccountToken, error) {
+	var stored models.AccountToken
+	if err := query.Where("token_hash = ? AND purpose = ?", auth.HashToken(token), purpose).
+		First(&stored).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidAccountToken
+		}
+		return nil, err
+	}
+
+	if stored.UsedAt != nil || stored.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidAccountToken
+	}
+	return &stored, nil
+}
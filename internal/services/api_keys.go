@@ -0,0 +1,112 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/auth"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+)
+
+const (
+	// Keys look like frz_<random>; the first characters are shown to help
+	// users recognise them
+	apiKeyPrefix       = "frz_"
+	apiKeyVisibleChars = len(apiKeyPrefix) + 8
+
+	// Last-used details are written at most this often per key
+	apiKeyTouchInterval = time.Minute
+
+	rateLimitWindow = time.Minute
+)
+
+// GenerateAPIKey returns a new key and the visible prefix to store with
+// its hash.
+func GenerateAPIKey() (key, prefix string, err error) {
+	random, err := auth.RandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	key = apiKeyPrefix + random
+	return key, key[:apiKeyVisibleChars], nil
+}
+
+// FindAPIKey returns the key matching the presented value, or nil if it is
+// unknown or expired. It records when and from where the key was used.
+func FindAPIKey(presented, ip string) (*models.APIKey, error) {
+	if !strings.HasPrefix(presented, apiKeyPrefix) {
+		return nil, nil
+	}
+
+	var key models.APIKey
+	result := db.DB.Where("key_hash = ?", auth.HashToken(presented)).Limit(1).Find(&key)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || key.Expired() {
+		return nil, nil
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval || key.LastUsedIP != ip {
+		if err := db.DB.Model(&key).UpdateColumns(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": ip,
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &key, nil
+}
+
+// RateLimiter counts requests per key in fixed one-minute windows. Counts
+// are per server.
+type RateLimiter struct {
+	limit int
+
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func NewRateLimiter(limit int) *RateLimiter {
+	return &RateLimiter{limit: limit, windows: make(map[string]*rateWindow)}
+}
+
+// Allow records a request for key. It reports whether the request is
+// within the limit, how many remain in the window and when it resets.
+func (l *RateLimiter) Allow(key string) (bool, int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= rateLimitWindow {
+		// Drop finished windows so idle keys do not accumulate
+		for k, old := range l.windows {
+			if now.Sub(old.start) >= rateLimitWindow {
+				delete(l.windows, k)
+			}
+		}
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+
+	reset := w.start.Add(rateLimitWindow)
+	if w.count >= l.limit {
+		return false, 0, reset
+	}
+	w.count++
+	return true, l.limit - w.count, reset
+}
+
+// Limit is the number of requests allowed per window.
+func (l *RateLimiter) Limit() int {
+	return l.limit
+}
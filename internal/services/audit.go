@@ -0,0 +1,28 @@
+package services
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+)
+
+// RecordAuditEvent logs event and stores it. Failing to store it is
+// logged but does not fail the caller.
+func RecordAuditEvent(event string, userID *uint, ip, detail string) {
+	user := "none"
+	if userID != nil {
+		user = fmt.Sprint(*userID)
+	}
+	log.Printf("Audit: %s user=%s ip=%s %s", event, user, ip, detail)
+
+	if err := db.DB.Create(&models.AuditEvent{
+		Event:  event,
+		UserID: userID,
+		IP:     ip,
+		Detail: detail,
+	}).Error; err != nil {
+		log.Printf("Error storing audit event %s: %v", event, err)
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import "regexp"
+
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// Above this many token comparisons the diff falls back to replacing the
+// whole changed middle. Diffs are computed for unauthenticated share
+// views, so this keeps each one to about a megabyte and a few
+// milliseconds however long the texts are.
+const maxDiffCells = 250_000
+
+var diffToken = regexp.MustCompile(`\s+|[\p{L}\p{N}'’]+|[^\s\p{L}\p{N}]`)
+
+// DiffOp is one run of a diff: text that is in both versions, only in the
+// new one (insert) or only in the old one (delete).
+type DiffOp struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// WordDiff compares two texts word by word, keeping whitespace and
+// punctuation as their own tokens so the ops concatenate back to either
+// text.
+func WordDiff(before, after string) []DiffOp {
+	a := diffToken.FindAllString(before, -1)
+	b := diffToken.FindAllString(after, -1)
+
+	var ops []DiffOp
+	add := func(kind, text string) {
+		if n := len(ops); n > 0 && ops[n-1].Type == kind {
+			ops[n-1].Text += text
+			return
+		}
+		ops = append(ops, DiffOp{Type: kind, Text: text})
+	}
+
+	// The common prefix and suffix need no comparison table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	for _, t := range a[:prefix] {
+		add(DiffEqual, t)
+	}
+
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+	if len(midA)*len(midB) > maxDiffCells {
+		for _, t := range midA {
+			add(DiffDelete, t)
+		}
+		for _, t := range midB {
+			add(DiffInsert, t)
+		}
+	} else {
+		diffLCS(midA, midB, add)
+	}
+
+	for _, t := range a[len(a)-suffix:] {
+		add(DiffEqual, t)
+	}
+
+	return ops
+}
+
+// diffLCS emits the ops turning a into b along a longest common
+// subsequence, deletions before insertions within each change.
+func diffLCS(a, b []string, add func(kind, text string)) {
+	n, m := len(a), len(b)
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			add(DiffEqual, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(DiffDelete, a[i])
+			i++
+		default:
+			add(DiffInsert, b[j])
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		add(DiffDelete, a[i])
+	}
+	for ; j < m; j++ {
+		add(DiffInsert, b[j])
+	}
+}
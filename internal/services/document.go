@@ -0,0 +1,346 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	DocumentFormatDOCX     = "docx"
+	DocumentFormatText     = "txt"
+	DocumentFormatMarkdown = "md"
+	DocumentFormatSRT      = "srt"
+)
+
+var documentContentTypes = map[string]string{
+	DocumentFormatDOCX:     "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	DocumentFormatText:     "text/plain; charset=utf-8",
+	DocumentFormatMarkdown: "text/markdown; charset=utf-8",
+	DocumentFormatSRT:      "application/x-subrip; charset=utf-8",
+}
+
+// Document is an uploaded file split into paraphrasable segments. Everything
+// that is not a segment (markup, list markers, subtitle timings) is kept
+// aside so the file can be rebuilt with new segment text.
+type Document struct {
+	Format   string
+	Segments []string
+	render   func(segments []string) ([]byte, error)
+}
+
+// ParseDocument detects the format from the file extension and extracts
+// its segments: paragraphs for DOCX, TXT and Markdown, cues for SRT.
+func ParseDocument(filename string, data []byte) (*Document, error) {
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	if format == "markdown" {
+		format = DocumentFormatMarkdown
+	}
+
+	switch format {
+	case DocumentFormatDOCX:
+		return parseDOCX(data)
+	case DocumentFormatText:
+		return parseText(string(data)), nil
+	case DocumentFormatMarkdown:
+		return parseMarkdown(string(data)), nil
+	case DocumentFormatSRT:
+		return parseSRT(string(data)), nil
+	}
+
+	return nil, fmt.Errorf("unsupported document format: %q", format)
+}
+
+// Render rebuilds the document with segments in place of the originals.
+func (d *Document) Render(segments []string) ([]byte, error) {
+	if len(segments) != len(d.Segments) {
+		return nil, fmt.Errorf("expected %d segments, got %d", len(d.Segments), len(segments))
+	}
+	return d.render(segments)
+}
+
+func (d *Document) ContentType() string {
+	return documentContentTypes[d.Format]
+}
+
+// Text joins the segments into a single plain-text body.
+func (d *Document) Text() string {
+	return strings.Join(d.Segments, "\n\n")
+}
+
+// textTemplate collects literal text and segments in document order.
+type textTemplate struct {
+	literals []string
+	segments []string
+	pending  strings.Builder
+}
+
+func (t *textTemplate) literal(s string) {
+	t.pending.WriteString(s)
+}
+
+// segment adds s as a segment, moving surrounding whitespace into the
+// literals so the layout survives whatever the model does with it.
+func (t *textTemplate) segment(s string) {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		t.literal(s)
+		return
+	}
+
+	start := strings.Index(s, trimmed)
+	t.literal(s[:start])
+	t.literals = append(t.literals, t.pending.String())
+	t.pending.Reset()
+	t.segments = append(t.segments, trimmed)
+	t.literal(s[start+len(trimmed):])
+}
+
+func (t *textTemplate) document(format string) *Document {
+	literals := append(t.literals, t.pending.String())
+	return &Document{
+		Format:   format,
+		Segments: t.segments,
+		render: func(segments []string) ([]byte, error) {
+			var b strings.Builder
+			for i, segment := range segments {
+				b.WriteString(literals[i])
+				b.WriteString(strings.TrimSpace(segment))
+			}
+			b.WriteString(literals[len(literals)-1])
+			return []byte(b.String()), nil
+		},
+	}
+}
+
+var paragraphBreak = regexp.MustCompile(`(?:\r?\n[ \t]*){2,}`)
+
+func parseText(content string) *Document {
+	var t textTemplate
+	last := 0
+	for _, loc := range paragraphBreak.FindAllStringIndex(content, -1) {
+		t.segment(content[last:loc[0]])
+		t.literal(content[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	t.segment(content[last:])
+	return t.document(DocumentFormatText)
+}
+
+var (
+	markdownFence  = regexp.MustCompile("^\\s*(```|~~~)")
+	markdownPrefix = regexp.MustCompile(`^\s*(?:#{1,6}\s+|[-*+]\s+(?:\[[ xX]\]\s+)?|\d+[.)]\s+|>\s?)+`)
+	markdownRaw    = regexp.MustCompile(`^\s*(?:\||<|(?:[-*_]\s*){3,}$|\[[^\]]+\]:)`)
+)
+
+// parseMarkdown treats each run of plain lines as one paragraph segment and
+// each heading, list item or quote line as its own segment with the marker
+// kept. Code blocks, tables, HTML and rules are left untouched.
+func parseMarkdown(content string) *Document {
+	var t textTemplate
+	var paragraph strings.Builder
+	inFence := ""
+
+	flush := func() {
+		if paragraph.Len() > 0 {
+			t.segment(paragraph.String())
+			paragraph.Reset()
+		}
+	}
+
+	for _, line := range strings.SplitAfter(content, "\n") {
+		body := strings.TrimRight(line, "\r\n")
+		ending := line[len(body):]
+
+		if inFence != "" {
+			t.literal(line)
+			if strings.HasPrefix(strings.TrimSpace(body), inFence) {
+				inFence = ""
+			}
+			continue
+		}
+
+		if m := markdownFence.FindStringSubmatch(body); m != nil {
+			flush()
+			inFence = m[1]
+			t.literal(line)
+			continue
+		}
+
+		if strings.TrimSpace(body) == "" || markdownRaw.MatchString(body) {
+			flush()
+			t.literal(line)
+			continue
+		}
+
+		if prefix := markdownPrefix.FindString(body); prefix != "" {
+			flush()
+			t.literal(prefix)
+			t.segment(body[len(prefix):])
+			t.literal(ending)
+			continue
+		}
+
+		paragraph.WriteString(line)
+	}
+	flush()
+
+	return t.document(DocumentFormatMarkdown)
+}
+
+// parseSRT keeps each cue's index and timing line and exposes its text.
+func parseSRT(content string) *Document {
+	var t textTemplate
+	content = strings.TrimPrefix(content, "\ufeff")
+
+	last := 0
+	for _, loc := range paragraphBreak.FindAllStringIndex(content, -1) {
+		addSRTCue(&t, content[last:loc[0]])
+		t.literal(content[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	addSRTCue(&t, content[last:])
+
+	return t.document(DocumentFormatSRT)
+}
+
+func addSRTCue(t *textTemplate, cue string) {
+	lines := strings.SplitAfter(cue, "\n")
+	for i, line := range lines {
+		if strings.Contains(line, "-->") {
+			t.literal(strings.Join(lines[:i+1], ""))
+			t.segment(strings.Join(lines[i+1:], ""))
+			return
+		}
+	}
+	// Not a cue we understand, keep it as is
+	t.literal(cue)
+}
+
+var (
+	docxParagraph = regexp.MustCompile(`(?s)<w:p(?:\s[^>]*)?/>|<w:p(?:\s[^>]*)?>.*?</w:p>`)
+	docxText      = regexp.MustCompile(`(?s)<w:t(?:\s[^>]*)?>(.*?)</w:t>`)
+)
+
+const docxBody = "word/document.xml"
+
+// Largest document.xml read from a docx. The upload limit applies to the
+// compressed file, which can expand a thousandfold.
+const maxDOCXBodySize = 50 << 20
+
+// parseDOCX extracts one segment per paragraph of the main document part.
+// On render the paragraph's text is written into its first run and the
+// other runs are emptied, so paragraph and run properties are preserved.
+func parseDOCX(data []byte) (*Document, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid docx file: %v", err)
+	}
+
+	var body []byte
+	for _, f := range zr.File {
+		if f.Name != docxBody {
+			continue
+		}
+		if f.UncompressedSize64 > maxDOCXBodySize {
+			return nil, fmt.Errorf("document is too large once uncompressed")
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %v", docxBody, err)
+		}
+		// The recorded size can lie, so the read is capped as well
+		body, err = io.ReadAll(io.LimitReader(rc, maxDOCXBodySize+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", docxBody, err)
+		}
+		if len(body) > maxDOCXBodySize {
+			return nil, fmt.Errorf("document is too large once uncompressed")
+		}
+	}
+	if body == nil {
+		return nil, fmt.Errorf("invalid docx file: missing %s", docxBody)
+	}
+
+	// Spans of body that hold a paragraph with text, in order
+	var spans [][]int
+	var segments []string
+	for _, loc := range docxParagraph.FindAllIndex(body, -1) {
+		var text strings.Builder
+		for _, m := range docxText.FindAllSubmatch(body[loc[0]:loc[1]], -1) {
+			text.WriteString(html.UnescapeString(string(m[1])))
+		}
+		if strings.TrimSpace(text.String()) == "" {
+			continue
+		}
+		spans = append(spans, loc)
+		segments = append(segments, text.String())
+	}
+
+	render := func(replacements []string) ([]byte, error) {
+		var out bytes.Buffer
+		last := 0
+		for i, loc := range spans {
+			out.Write(body[last:loc[0]])
+			out.Write(replaceDOCXParagraphText(body[loc[0]:loc[1]], replacements[i]))
+			last = loc[1]
+		}
+		out.Write(body[last:])
+		return rewriteZipEntry(zr, docxBody, out.Bytes())
+	}
+
+	return &Document{Format: DocumentFormatDOCX, Segments: segments, render: render}, nil
+}
+
+func replaceDOCXParagraphText(paragraph []byte, text string) []byte {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(text))
+
+	first := true
+	return docxText.ReplaceAllFunc(paragraph, func([]byte) []byte {
+		if !first {
+			return []byte("<w:t></w:t>")
+		}
+		first = false
+		return append([]byte(`<w:t xml:space="preserve">`), append(escaped.Bytes(), "</w:t>"...)...)
+	})
+}
+
+// rewriteZipEntry copies the archive, replacing the content of one entry.
+func rewriteZipEntry(zr *zip.Reader, name string, content []byte) ([]byte, error) {
+	var out bytes.Buffer
+	zw := zip.NewWriter(&out)
+
+	for _, f := range zr.File {
+		if f.Name != name {
+			if err := zw.Copy(f); err != nil {
+				return nil, fmt.Errorf("failed to copy %s: %v", f.Name, err)
+			}
+			continue
+		}
+
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.Name,
+			Method:   zip.Deflate,
+			Modified: f.Modified,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s: %v", f.Name, err)
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", f.Name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,388 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"gorm.io/gorm"
+)
+
+// Encrypted text is stored as "enc:v1:<user key id>:<base64 nonce+ciphertext>"
+const ciphertextPrefix = "enc:v1:"
+
+// EnvelopeCipher encrypts history text with AES-256-GCM under per-user data
+// keys. Data keys are stored wrapped by the master key and cached unwrapped
+// in memory. Ciphertext is bound to its user, so it cannot be moved to
+// another account's rows.
+type EnvelopeCipher struct {
+	masterKeys map[string][]byte // by fingerprint
+	current    string            // fingerprint of the key new data keys are wrapped with
+
+	mu     sync.Mutex
+	keys   map[uint]*dataKey // by UserKey ID
+	active map[uint]uint     // user ID to active UserKey ID
+}
+
+type dataKey struct {
+	userID uint
+	aead   cipher.AEAD
+}
+
+// InitHistoryEncryption makes history encryption available when a master
+// key is configured. Without one it refuses to start if any history is
+// encrypted, since every read that loads such an entry would fail.
+func InitHistoryEncryption(cfg *config.Config) *EnvelopeCipher {
+	if cfg.HistoryEncryptionKey == "" {
+		var encrypted bool
+		if err := db.DB.Raw("SELECT EXISTS (SELECT 1 FROM paraphrase_histories WHERE encrypted)").
+			Scan(&encrypted).Error; err != nil {
+			log.Fatalf("Failed to check for encrypted history: %v", err)
+		}
+		if encrypted {
+			log.Fatal("History is encrypted but HISTORY_ENCRYPTION_KEY is not set")
+		}
+		return nil
+	}
+	envelope, err := NewEnvelopeCipher(cfg.HistoryEncryptionKey, cfg.HistoryEncryptionOldKeys)
+	if err != nil {
+		log.Fatalf("Invalid history encryption key: %v", err)
+	}
+	models.HistoryCipher = envelope
+	return envelope
+}
+
+// NewEnvelopeCipher takes the current master key and any previous ones
+// still wrapping data keys, each base64-encoded 32 bytes.
+func NewEnvelopeCipher(masterKey string, oldKeys []string) (*EnvelopeCipher, error) {
+	c := &EnvelopeCipher{
+		masterKeys: make(map[string][]byte),
+		keys:       make(map[uint]*dataKey),
+		active:     make(map[uint]uint),
+	}
+
+	for i, encoded := range append([]string{masterKey}, oldKeys...) {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("master keys must be base64-encoded 32 bytes")
+		}
+		fingerprint := masterKeyFingerprint(key)
+		c.masterKeys[fingerprint] = key
+		if i == 0 {
+			c.current = fingerprint
+		}
+	}
+
+	return c, nil
+}
+
+func masterKeyFingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
+
+func userKeyAAD(userID uint) []byte {
+	return []byte(fmt.Sprintf("user-key:%d", userID))
+}
+
+func textAAD(userID uint) []byte {
+	return []byte(fmt.Sprintf("history-text:%d", userID))
+}
+
+func (c *EnvelopeCipher) Encrypt(userID uint, plaintext string) (string, error) {
+	keyID, key, err := c.activeKey(userID)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := seal(key.aead, []byte(plaintext), textAAD(userID))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%d:%s", ciphertextPrefix, keyID, base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+func (c *EnvelopeCipher) Decrypt(userID uint, ciphertext string) (string, error) {
+	rest, ok := strings.CutPrefix(ciphertext, ciphertextPrefix)
+	if !ok {
+		return "", fmt.Errorf("unrecognised ciphertext format")
+	}
+	idPart, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", fmt.Errorf("unrecognised ciphertext format")
+	}
+	keyID, err := strconv.ParseUint(idPart, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("unrecognised ciphertext format")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("unrecognised ciphertext format")
+	}
+
+	key, err := c.dataKey(uint(keyID))
+	if err != nil {
+		return "", err
+	}
+	if key.userID != userID {
+		return "", fmt.Errorf("ciphertext belongs to another user")
+	}
+
+	plaintext, err := open(key.aead, sealed, textAAD(userID))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt text: %v", err)
+	}
+	return string(plaintext), nil
+}
+
+// activeKey returns the user's active data key, creating one if needed.
+func (c *EnvelopeCipher) activeKey(userID uint) (uint, *dataKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if id, ok := c.active[userID]; ok {
+		return id, c.keys[id], nil
+	}
+
+	var userKey models.UserKey
+	err := db.DB.Where("user_id = ? AND active", userID).First(&userKey).Error
+	if err == gorm.ErrRecordNotFound {
+		userKey, err = c.createKey(userID)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	key, err := c.unwrap(userKey)
+	if err != nil {
+		return 0, nil, err
+	}
+	c.keys[userKey.ID] = key
+	c.active[userID] = userKey.ID
+	return userKey.ID, key, nil
+}
+
+// dataKey returns the data key with the given ID, active or not.
+func (c *EnvelopeCipher) dataKey(id uint) (*dataKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[id]; ok {
+		return key, nil
+	}
+
+	var userKey models.UserKey
+	if err := db.DB.First(&userKey, id).Error; err != nil {
+		return nil, fmt.Errorf("data key %d not found", id)
+	}
+
+	key, err := c.unwrap(userKey)
+	if err != nil {
+		return nil, err
+	}
+	c.keys[id] = key
+	return key, nil
+}
+
+func (c *EnvelopeCipher) createKey(userID uint) (models.UserKey, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return models.UserKey{}, err
+	}
+
+	wrapped, err := c.wrap(userID, raw)
+	if err != nil {
+		return models.UserKey{}, err
+	}
+
+	userKey := models.UserKey{UserID: userID, WrappedKey: wrapped, MasterKeyID: c.current, Active: true}
+	if err := db.DB.Create(&userKey).Error; err != nil {
+		// Another server may have created one first
+		if findErr := db.DB.Where("user_id = ? AND active", userID).First(&userKey).Error; findErr != nil {
+			return models.UserKey{}, err
+		}
+	}
+	return userKey, nil
+}
+
+func (c *EnvelopeCipher) wrap(userID uint, raw []byte) ([]byte, error) {
+	aead, err := newAEAD(c.masterKeys[c.current])
+	if err != nil {
+		return nil, err
+	}
+	return seal(aead, raw, userKeyAAD(userID))
+}
+
+func (c *EnvelopeCipher) unwrapRaw(userKey models.UserKey) ([]byte, error) {
+	master, ok := c.masterKeys[userKey.MasterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %s is not configured", userKey.MasterKeyID)
+	}
+	aead, err := newAEAD(master)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := open(aead, userKey.WrappedKey, userKeyAAD(userKey.UserID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key %d: %v", userKey.ID, err)
+	}
+	return raw, nil
+}
+
+func (c *EnvelopeCipher) unwrap(userKey models.UserKey) (*dataKey, error) {
+	raw, err := c.unwrapRaw(userKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &dataKey{userID: userKey.UserID, aead: aead}, nil
+}
+
+// RewrapDataKeys re-wraps every data key not wrapped by the current master
+// key, so old master keys can be retired. It returns how many were
+// re-wrapped.
+func (c *EnvelopeCipher) RewrapDataKeys() (int, error) {
+	var keys []models.UserKey
+	if err := db.DB.Where("master_key_id <> ?", c.current).Find(&keys).Error; err != nil {
+		return 0, err
+	}
+
+	for i, userKey := range keys {
+		raw, err := c.unwrapRaw(userKey)
+		if err != nil {
+			return i, err
+		}
+		wrapped, err := c.wrap(userKey.UserID, raw)
+		if err != nil {
+			return i, err
+		}
+		if err := db.DB.Model(&userKey).Updates(map[string]interface{}{
+			"wrapped_key":   wrapped,
+			"master_key_id": c.current,
+		}).Error; err != nil {
+			return i, err
+		}
+	}
+	return len(keys), nil
+}
+
+// RotateDataKey retires the user's active data key so new text, and text
+// re-encrypted by ReencryptUserHistory, uses a fresh one.
+func (c *EnvelopeCipher) RotateDataKey(userID uint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := db.DB.Model(&models.UserKey{}).
+		Where("user_id = ? AND active", userID).
+		Update("active", false).Error; err != nil {
+		return err
+	}
+	delete(c.active, userID)
+	return nil
+}
+
+// ReencryptUserHistory brings every stored entry of the user in line with
+// their encryption setting: encrypted under the active data key if it is
+// on, plain text if it is off. Data keys no longer in use are then deleted.
+// Turning encryption on also removes the user's job results, which are
+// stored as plain files.
+func ReencryptUserHistory(userID uint) error {
+	var user models.User
+	if err := db.DB.Select("id", "encrypt_history").First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	if user.EncryptHistory {
+		var jobs []models.Job
+		if err := db.DB.Select("id", "result_path").
+			Where("user_id = ? AND result_path <> ''", userID).
+			Find(&jobs).Error; err != nil {
+			return err
+		}
+		for i := range jobs {
+			RemoveJobResult(&jobs[i])
+		}
+	}
+
+	query := db.DB.Unscoped().Where("user_id = ? AND NOT redacted", userID)
+	if !user.EncryptHistory {
+		query = query.Where("encrypted")
+	}
+
+	// Rows are decrypted as they are loaded
+	var batch []models.ParaphraseHistory
+	result := query.FindInBatches(&batch, 200, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			h := &batch[i]
+			if user.EncryptHistory {
+				if err := h.EncryptText(); err != nil {
+					return err
+				}
+			}
+			if err := db.DB.Unscoped().Model(&models.ParaphraseHistory{}).
+				Where("id = ?", h.ID).
+				UpdateColumns(map[string]interface{}{
+					"original_text":    h.OriginalText,
+					"paraphrased_text": h.ParaphrasedText,
+					"edits":            h.Edits,
+					"encrypted":        h.Encrypted,
+				}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	// A server that has not yet seen a rotation may still have written
+	// rows with the retired key, so only unreferenced keys go
+	cleanup := db.DB.Where("user_id = ?", userID).Where(`NOT EXISTS (
+		SELECT 1 FROM paraphrase_histories
+		WHERE paraphrase_histories.user_id = user_keys.user_id AND encrypted
+			AND (original_text || paraphrased_text || COALESCE(edits::text, '')) LIKE '%' || ? || user_keys.id || ':%')`,
+		ciphertextPrefix)
+	if user.EncryptHistory {
+		cleanup = cleanup.Where("NOT active")
+	}
+	return cleanup.Delete(&models.UserKey{}).Error
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	ExportFormatCSV   = "csv"
+	ExportFormatJSONL = "jsonl"
+	ExportFormatDOCX  = DocumentFormatDOCX
+)
+
+var exportContentTypes = map[string]string{
+	ExportFormatCSV:   "text/csv; charset=utf-8",
+	ExportFormatJSONL: "application/x-ndjson; charset=utf-8",
+	ExportFormatDOCX:  documentContentTypes[DocumentFormatDOCX],
+}
+
+// Rows are read from the database this many at a time
+const exportBatchSize = 500
+
+// ExportContentType returns the MIME type of an export format, or false if
+// the format is not supported.
+func ExportContentType(format string) (string, bool) {
+	contentType, ok := exportContentTypes[format]
+	return contentType, ok
+}
+
+// historyExportWriter writes history entries one at a time in some format.
+// Close finishes the output but does not close the underlying writer.
+type historyExportWriter interface {
+	Write(h *models.ParaphraseHistory) error
+	Close() error
+}
+
+// ExportHistory writes every entry matched by query to w in the given
+// format, in id order. Entries are read in batches so memory use does not
+// grow with the size of the history; after each batch progress is called
+// with the number of entries written so far.
+func ExportHistory(w io.Writer, format string, query *gorm.DB, progress func(done int)) error {
+	var out historyExportWriter
+	switch format {
+	case ExportFormatCSV:
+		out = newCSVExportWriter(w)
+	case ExportFormatJSONL:
+		out = &jsonlExportWriter{enc: json.NewEncoder(w)}
+	case ExportFormatDOCX:
+		var err error
+		if out, err = newDOCXExportWriter(w); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+
+	done := 0
+	var batch []models.ParaphraseHistory
+	result := query.FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := out.Write(&batch[i]); err != nil {
+				return err
+			}
+		}
+		done += len(batch)
+		if f, ok := out.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+		if progress != nil {
+			progress(done)
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return out.Close()
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func newCSVExportWriter(w io.Writer) *csvExportWriter {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "created_at", "language", "style", "mode", "original_text", "paraphrased_text"})
+	return &csvExportWriter{w: cw}
+}
+
+func (e *csvExportWriter) Write(h *models.ParaphraseHistory) error {
+	return e.w.Write([]string{
+		strconv.FormatUint(uint64(h.ID), 10),
+		h.CreatedAt.UTC().Format(time.RFC3339),
+		csvSafe(h.Language),
+		csvSafe(h.Style),
+		h.Mode,
+		csvSafe(h.OriginalText),
+		csvSafe(h.ParaphrasedText),
+	})
+}
+
+func (e *csvExportWriter) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExportWriter) Close() error {
+	return e.Flush()
+}
+
+// csvSafe stops spreadsheet applications from treating a cell as a formula.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+type jsonlExportWriter struct {
+	enc *json.Encoder
+}
+
+type exportRecord struct {
+	ID              uint      `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	Language        string    `json:"language"`
+	Style           string    `json:"style"`
+	Mode            string    `json:"mode"`
+	OriginalText    string    `json:"original_text"`
+	ParaphrasedText string    `json:"paraphrased_text"`
+}
+
+func (e *jsonlExportWriter) Write(h *models.ParaphraseHistory) error {
+	return e.enc.Encode(exportRecord{
+		ID:              h.ID,
+		CreatedAt:       h.CreatedAt.UTC(),
+		Language:        h.Language,
+		Style:           h.Style,
+		Mode:            h.Mode,
+		OriginalText:    h.OriginalText,
+		ParaphrasedText: h.ParaphrasedText,
+	})
+}
+
+func (e *jsonlExportWriter) Close() error {
+	return nil
+}
+
+const (
+	docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/></Types>`
+	docxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/></Relationships>`
+	docxDocumentStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`
+	docxDocumentEnd = `<w:sectPr/></w:body></w:document>`
+)
+
+// docxExportWriter builds a minimal Word document. The zip is written as it
+// goes, with the document part last so entries can be streamed into it.
+type docxExportWriter struct {
+	zw   *zip.Writer
+	body io.Writer
+}
+
+func newDOCXExportWriter(w io.Writer) (*docxExportWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxRels},
+	} {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := zw.Create(docxBody)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(body, docxDocumentStart); err != nil {
+		return nil, err
+	}
+	return &docxExportWriter{zw: zw, body: body}, nil
+}
+
+func (e *docxExportWriter) Write(h *models.ParaphraseHistory) error {
+	heading := fmt.Sprintf("%s · %s · %s", h.CreatedAt.UTC().Format("2006-01-02 15:04 MST"), h.Language, h.Style)
+	if err := e.paragraph(heading, true); err != nil {
+		return err
+	}
+	if err := e.section("Original", h.OriginalText); err != nil {
+		return err
+	}
+	if err := e.section("Result", h.ParaphrasedText); err != nil {
+		return err
+	}
+	return e.paragraph("", false)
+}
+
+// section writes a bold label followed by text, one paragraph per line.
+func (e *docxExportWriter) section(label, text string) error {
+	if err := e.paragraph(label, true); err != nil {
+		return err
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if err := e.paragraph(strings.TrimRight(line, "\r"), false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *docxExportWriter) paragraph(text string, bold bool) error {
+	var b strings.Builder
+	b.WriteString("<w:p><w:r>")
+	if bold {
+		b.WriteString("<w:rPr><w:b/></w:rPr>")
+	}
+	b.WriteString(`<w:t xml:space="preserve">`)
+	xml.EscapeText(&b, []byte(text))
+	b.WriteString("</w:t></w:r></w:p>")
+	_, err := io.WriteString(e.body, b.String())
+	return err
+}
+
+func (e *docxExportWriter) Flush() error {
+	return e.zw.Flush()
+}
+
+func (e *docxExportWriter) Close() error {
+	if _, err := io.WriteString(e.body, docxDocumentEnd); err != nil {
+		return err
+	}
+	return e.zw.Close()
+}
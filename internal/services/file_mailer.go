@@ -0,0 +1,36 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/config"
+)
+
+// FileMailer is for development: messages are written to dir as .eml
+// files. Only where they went is logged, never their contents.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(cfg *config.Config) *FileMailer {
+	return &FileMailer{dir: cfg.MailDir, from: cfg.MailFrom}
+}
+
+func (m *FileMailer) Send(email Email) error {
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), filepath.Base(email.To))
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, formatMessage(m.from, email), 0o600); err != nil {
+		return err
+	}
+
+	log.Printf("Wrote %q email to %s", email.Subject, path)
+	return nil
+}
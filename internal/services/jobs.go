@@ -0,0 +1,197 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+)
+
+const jobPurgeInterval = time.Hour
+
+// JobFunc does the work for a job. It may update job fields such as
+// FileName or Progress, and write a result file; the runner persists the
+// final state.
+type JobFunc func(job *models.Job) error
+
+type queuedJob struct {
+	job *models.Job
+	fn  JobFunc
+}
+
+// JobRunner executes jobs on a fixed pool of background workers. Results
+// are written to files under resultDir and kept for resultTTL.
+type JobRunner struct {
+	queue     chan queuedJob
+	resultDir string
+	resultTTL time.Duration
+}
+
+func NewJobRunner(cfg *config.Config, workers int) *JobRunner {
+	// Jobs that were in flight when the server stopped will never finish,
+	// and any result they started writing is incomplete
+	var interrupted []models.Job
+	if err := db.DB.Select("id", "result_path").
+		Where("status IN (?)", []string{models.JobStatusQueued, models.JobStatusRunning}).
+		Find(&interrupted).Error; err != nil {
+		log.Printf("Warning: failed to find interrupted jobs: %v", err)
+	}
+	for i := range interrupted {
+		RemoveJobResult(&interrupted[i])
+	}
+	if err := db.DB.Model(&models.Job{}).
+		Where("status IN (?)", []string{models.JobStatusQueued, models.JobStatusRunning}).
+		Updates(map[string]interface{}{
+			"status": models.JobStatusFailed,
+			"error":  "interrupted by server restart",
+		}).Error; err != nil {
+		log.Printf("Warning: failed to mark interrupted jobs: %v", err)
+	}
+
+	r := &JobRunner{
+		queue:     make(chan queuedJob, 100),
+		resultDir: cfg.JobResultDir,
+		resultTTL: time.Duration(cfg.JobResultTTLHours) * time.Hour,
+	}
+	for i := 0; i < workers; i++ {
+		go r.work()
+	}
+	return r
+}
+
+// Enqueue saves the job as queued and schedules fn to run it.
+func (r *JobRunner) Enqueue(job *models.Job, fn JobFunc) error {
+	job.Status = models.JobStatusQueued
+	if err := db.DB.Create(job).Error; err != nil {
+		return fmt.Errorf("failed to create job: %v", err)
+	}
+
+	select {
+	case r.queue <- queuedJob{job: job, fn: fn}:
+		return nil
+	default:
+		job.Status = models.JobStatusFailed
+		job.Error = "job queue is full"
+		db.DB.Save(job)
+		return fmt.Errorf("job queue is full")
+	}
+}
+
+// UpdateProgress stores the percentage of work done so far.
+func (r *JobRunner) UpdateProgress(job *models.Job, done, total int) {
+	if total <= 0 {
+		return
+	}
+	job.Progress = done * 100 / total
+	if err := db.DB.Model(job).Update("progress", job.Progress).Error; err != nil {
+		log.Printf("Failed to update progress for job %d: %v", job.ID, err)
+	}
+}
+
+// CreateResultFile creates the file that holds job's result and records
+// its path straight away, so it is cleaned up even if the server stops
+// while it is being written. The caller writes the result and closes it.
+func (r *JobRunner) CreateResultFile(job *models.Job) (*os.File, error) {
+	if err := os.MkdirAll(r.resultDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create result directory: %v", err)
+	}
+	f, err := os.CreateTemp(r.resultDir, fmt.Sprintf("job-%d-*", job.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create result file: %v", err)
+	}
+
+	job.ResultPath = f.Name()
+	if err := db.DB.Model(job).Update("result_path", job.ResultPath).Error; err != nil {
+		f.Close()
+		os.Remove(job.ResultPath)
+		job.ResultPath = ""
+		return nil, err
+	}
+	return f, nil
+}
+
+// SaveResult writes data as job's result.
+func (r *JobRunner) SaveResult(job *models.Job, data []byte) error {
+	f, err := r.CreateResultFile(job)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// RemoveJobResult deletes job's result file, if it has one.
+func RemoveJobResult(job *models.Job) {
+	if job.ResultPath == "" {
+		return
+	}
+	if err := os.Remove(job.ResultPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove result of job %d: %v", job.ID, err)
+		return
+	}
+	job.ResultPath = ""
+	if err := db.DB.Model(job).Update("result_path", "").Error; err != nil {
+		log.Printf("Failed to clear result of job %d: %v", job.ID, err)
+	}
+}
+
+func (r *JobRunner) work() {
+	for q := range r.queue {
+		job := q.job
+		job.Status = models.JobStatusRunning
+		if err := db.DB.Save(job).Error; err != nil {
+			log.Printf("Failed to start job %d: %v", job.ID, err)
+		}
+
+		err := q.fn(job)
+
+		now := time.Now()
+		job.CompletedAt = &now
+		if err != nil {
+			log.Printf("Job %d (%s) failed: %v", job.ID, job.Kind, err)
+			job.Status = models.JobStatusFailed
+			job.Error = err.Error()
+			RemoveJobResult(job)
+		} else {
+			job.Status = models.JobStatusCompleted
+			job.Progress = 100
+			if job.ResultPath != "" {
+				expires := now.Add(r.resultTTL)
+				job.ResultExpiresAt = &expires
+			}
+		}
+
+		if err := db.DB.Save(job).Error; err != nil {
+			log.Printf("Failed to save job %d: %v", job.ID, err)
+		}
+	}
+}
+
+// StartJobPurge removes job results that have expired, once at startup and
+// then every hour. The jobs themselves are kept.
+func StartJobPurge() {
+	go func() {
+		for {
+			var expired []models.Job
+			if err := db.DB.Select("id", "result_path").
+				Where("result_path <> '' AND result_expires_at < ?", time.Now()).
+				Find(&expired).Error; err != nil {
+				log.Printf("Error finding expired job results: %v", err)
+			}
+			for i := range expired {
+				RemoveJobResult(&expired[i])
+			}
+			if len(expired) > 0 {
+				log.Printf("Removed %d expired job results", len(expired))
+			}
+			time.Sleep(jobPurgeInterval)
+		}
+	}()
+}
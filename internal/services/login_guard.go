@@ -0,0 +1,260 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// Failed logins older than this no longer count against an account
+	loginFailureWindow = time.Hour
+
+	// After this many failures each further one doubles the wait before
+	// the next attempt, up to maxLoginDelay
+	loginFreeFailures = 3
+	maxLoginDelay     = time.Minute
+
+	// Failures from one IP are counted over this window
+	loginIPWindow = 15 * time.Minute
+
+	AccountUnlockTokenTTL = 24 * time.Hour
+)
+
+// LoginGuard throttles password logins per account and per IP. Accounts
+// that keep failing are locked for a while and emailed an unlock link.
+type LoginGuard struct {
+	cfg              *config.Config
+	mailer           Mailer
+	lockoutThreshold int
+	lockoutDuration  time.Duration
+	ipThreshold      int
+}
+
+// LoginThrottle says why a login may not be attempted yet.
+type LoginThrottle struct {
+	Locked     bool // the account is locked out
+	IPBlocked  bool // too many failures from this IP
+	RetryAfter time.Duration
+}
+
+func NewLoginGuard(cfg *config.Config, mailer Mailer) *LoginGuard {
+	return &LoginGuard{
+		cfg:              cfg,
+		mailer:           mailer,
+		lockoutThreshold: cfg.LoginLockoutThreshold,
+		lockoutDuration:  time.Duration(cfg.LoginLockoutMinutes) * time.Minute,
+		ipThreshold:      cfg.LoginIPThreshold,
+	}
+}
+
+// NormalizeLoginEmail returns the form of an email address that login
+// attempts are counted under.
+func NormalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Attempt makes one login attempt for email from ip. Unless the guard is
+// throttling them, verify checks the credentials and returns the account
+// they name, if any, and whether they were right. A failure is recorded
+// before Attempt returns; attempts for the same email or from the same IP
+// take turns, so parallel requests cannot slip past a limit.
+//
+// The user is returned only if verify succeeded. Success is not recorded
+// here, as a login may still need a second factor; call RecordSuccess once
+// it is complete.
+func (g *LoginGuard) Attempt(email, ip string, verify func() (*models.User, bool, error)) (*models.User, *LoginThrottle, error) {
+	var user *models.User
+	var throttle *LoginThrottle
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockLoginAttempts(tx, email, ip); err != nil {
+			return err
+		}
+
+		var err error
+		if throttle, err = g.check(tx, email, ip); err != nil || throttle != nil {
+			return err
+		}
+
+		found, ok, err := verify()
+		if err != nil {
+			return err
+		}
+		if ok {
+			user = found
+			return nil
+		}
+
+		throttle, err = g.recordFailure(tx, email, ip, found)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, throttle, nil
+}
+
+// Advisory lock namespaces, so an email and an IP never share a lock
+const (
+	loginLockEmail = 1
+	loginLockIP    = 2
+)
+
+// lockLoginAttempts holds tx's attempts for email and ip until it ends.
+// Every caller takes the email lock first, so they cannot deadlock.
+func lockLoginAttempts(tx *gorm.DB, email, ip string) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?::int, hashtext(?))", loginLockEmail, email).Error; err != nil {
+		return err
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock(?::int, hashtext(?))", loginLockIP, ip).Error
+}
+
+// check returns a throttle if a login for email from ip must wait, or nil
+// if it may go ahead.
+func (g *LoginGuard) check(tx *gorm.DB, email, ip string) (*LoginThrottle, error) {
+	now := time.Now()
+
+	// Blocked until enough of the IP's recent failures age out of the window
+	var oldest []time.Time
+	if err := tx.Model(&models.LoginAttempt{}).
+		Where("ip = ? AND NOT succeeded AND created_at > ?", ip, now.Add(-loginIPWindow)).
+		Order("created_at DESC").
+		Offset(g.ipThreshold-1).
+		Limit(1).
+		Pluck("created_at", &oldest).Error; err != nil {
+		return nil, err
+	}
+	if len(oldest) > 0 {
+		return &LoginThrottle{IPBlocked: true, RetryAfter: oldest[0].Add(loginIPWindow).Sub(now)}, nil
+	}
+
+	count, last, err := g.failures(tx, email)
+	if err != nil || last == nil {
+		return nil, err
+	}
+
+	if count >= g.lockoutThreshold {
+		if until := last.Add(g.lockoutDuration); until.After(now) {
+			return &LoginThrottle{Locked: true, RetryAfter: until.Sub(now)}, nil
+		}
+		return nil, nil
+	}
+
+	if count >= loginFreeFailures {
+		if wait := last.Add(loginDelay(count)); wait.After(now) {
+			return &LoginThrottle{RetryAfter: wait.Sub(now)}, nil
+		}
+	}
+	return nil, nil
+}
+
+func loginDelay(failures int) time.Duration {
+	shift := failures - loginFreeFailures
+	if shift > 6 {
+		return maxLoginDelay
+	}
+	delay := time.Second << shift
+	if delay > maxLoginDelay {
+		delay = maxLoginDelay
+	}
+	return delay
+}
+
+// failures counts the failed logins for email since its last success,
+// within the failure window, and returns the time of the latest.
+func (g *LoginGuard) failures(tx *gorm.DB, email string) (int, *time.Time, error) {
+	var result struct {
+		Count int
+		Last  *time.Time
+	}
+	err := tx.Model(&models.LoginAttempt{}).
+		Select("COUNT(*) AS count, MAX(created_at) AS last").
+		Where("email = ? AND NOT succeeded AND created_at > ?", email, time.Now().Add(-loginFailureWindow)).
+		Where("created_at > COALESCE((SELECT MAX(created_at) FROM login_attempts WHERE email = ? AND succeeded), '-infinity')", email).
+		Scan(&result).Error
+	return result.Count, result.Last, err
+}
+
+// recordFailure notes a failed login and reports whether it locked the
+// account. user is nil when no account has the email.
+func (g *LoginGuard) recordFailure(tx *gorm.DB, email, ip string, user *models.User) (*LoginThrottle, error) {
+	attempt := models.LoginAttempt{Email: email, IP: ip}
+	var userID *uint
+	if user != nil {
+		userID = &user.ID
+		attempt.UserID = userID
+	}
+	if err := tx.Create(&attempt).Error; err != nil {
+		return nil, err
+	}
+
+	var ipFailures int64
+	if err := tx.Model(&models.LoginAttempt{}).
+		Where("ip = ? AND NOT succeeded AND created_at > ?", ip, time.Now().Add(-loginIPWindow)).
+		Count(&ipFailures).Error; err != nil {
+		return nil, err
+	}
+	if int(ipFailures) == g.ipThreshold {
+		RecordAuditEvent(models.AuditLoginIPBlocked, nil, ip, fmt.Sprintf("%d failed logins in %s", ipFailures, loginIPWindow))
+	}
+
+	count, _, err := g.failures(tx, email)
+	if err != nil {
+		return nil, err
+	}
+	if count < g.lockoutThreshold {
+		return nil, nil
+	}
+
+	RecordAuditEvent(models.AuditLoginLockout, userID, ip, fmt.Sprintf("%d failed logins, locked for %s", count, g.lockoutDuration))
+
+	// Unknown emails are locked the same way, but there is no one to tell
+	if user != nil {
+		token, err := CreateAccountToken(user.ID, models.TokenPurposeAccountUnlock, email, AccountUnlockTokenTTL)
+		if err != nil {
+			log.Printf("Error creating unlock token for user %d: %v", user.ID, err)
+		} else {
+			SendEmailAsync(g.mailer, AccountUnlockEmail(g.cfg, user.Email, token, g.lockoutDuration))
+		}
+	}
+
+	return &LoginThrottle{Locked: true, RetryAfter: g.lockoutDuration}, nil
+}
+
+// RecordSuccess notes a successful login, which clears the failure count
+// for email.
+func (g *LoginGuard) RecordSuccess(email, ip string, userID uint) error {
+	return db.DB.Create(&models.LoginAttempt{Email: email, IP: ip, UserID: &userID, Succeeded: true}).Error
+}
+
+// Unlock clears the lockout named by an emailed unlock token.
+func (g *LoginGuard) Unlock(token, ip string) error {
+	var unlock *models.AccountToken
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		unlock, err = ConsumeAccountToken(tx, token, models.TokenPurposeAccountUnlock)
+		if err != nil {
+			return err
+		}
+
+		// A success row ends the run of failures, as a real login would
+		return tx.Create(&models.LoginAttempt{
+			Email:     unlock.Email,
+			IP:        ip,
+			UserID:    &unlock.UserID,
+			Succeeded: true,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	RecordAuditEvent(models.AuditAccountUnlock, &unlock.UserID, ip, "unlocked from emailed link")
+	return nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"log"
+
+	"github.com/arrinal/paraphrase-saas/internal/config"
+)
+
+// Email is a plain-text message to one recipient.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer defines methods that every mail backend must have
+type Mailer interface {
+	Send(email Email) error
+}
+
+// NewMailer returns the backend chosen by MAIL_BACKEND: smtp, or file for
+// development, which writes messages to MAIL_DIR. Messages carry account
+// links, so production refuses to start with anything but smtp.
+func NewMailer(cfg *config.Config) Mailer {
+	switch {
+	case cfg.MailBackend == "smtp":
+		return NewSMTPMailer(cfg)
+	case cfg.Environment == "production":
+		log.Fatalf("MAIL_BACKEND must be smtp in production, not %q", cfg.MailBackend)
+	case cfg.MailBackend != "file":
+		log.Fatalf("Unknown MAIL_BACKEND %q", cfg.MailBackend)
+	}
+	return NewFileMailer(cfg)
+}
+
+// SendEmailAsync sends email in the background, logging failures, so that
+// slow mail servers do not hold up requests or reveal through timing
+// whether a message was sent.
+func SendEmailAsync(mailer Mailer, email Email) {
+	go func() {
+		if err := mailer.Send(email); err != nil {
+			log.Printf("Error sending %q email: %v", email.Subject, err)
+		}
+	}()
+}
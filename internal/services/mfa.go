@@ -0,0 +1,70 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/auth"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	MFAChallengeTTL = 5 * time.Minute
+
+	// A challenge is cancelled after this many wrong codes
+	MaxMFAAttempts = 5
+
+	recoveryCodeCount = 10
+)
+
+// VerifySecondFactor checks a TOTP code, or failing that an unused
+// recovery code, for user within tx. A code that passes is spent.
+func VerifySecondFactor(tx *gorm.DB, user *models.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, strings.ReplaceAll(code, " ", ""), time.Now()); ok {
+		// Conditional, so two requests racing with the same code cannot
+		// both succeed
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected == 1 {
+			user.TOTPLastStep = step
+			return true, nil
+		}
+		return false, nil
+	}
+
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, auth.HashToken(auth.NormalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReplaceRecoveryCodes invalidates the user's recovery codes and returns a
+// fresh set. They are only ever shown this once.
+func ReplaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := auth.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(code))}
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
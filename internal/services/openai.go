@@ -11,8 +11,17 @@ import (
 	"github.com/arrinal/paraphrase-saas/internal/config"
 )
 
+// OpenAIModel is the chat model used for every text operation.
+const OpenAIModel = "gpt-4"
+
+// PromptVersion is stored with each result so ratings can be compared
+// across prompt changes. Bump it whenever a prompt changes in a way that
+// could affect output quality.
+const PromptVersion = "2026.10"
+
 type OpenAIService struct {
-	apiKey string
+	apiKey       string
+	preservation PreservationThresholds
 }
 
 type OpenAIRequest struct {
@@ -32,14 +41,27 @@ type OpenAIResponse struct {
 			Content string `json:"content"`
 		} `json:"message"`
 	} `json:"choices"`
+	Usage struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
 	Error *struct {
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
 }
 
 type ParaphraseResponse struct {
-	Paraphrased      string `json:"paraphrased"`
-	DetectedLanguage string `json:"detected_language"`
+	Paraphrased      string              `json:"paraphrased"`
+	DetectedLanguage string              `json:"detected_language"`
+	QualityWarnings  []string            `json:"quality_warnings,omitempty"`
+	Attempts         int                 `json:"attempts"`
+	Verification     *VerificationResult `json:"verification,omitempty"`
+	TokensUsed       int                 `json:"tokens_used"`
+}
+
+// ParaphraseOptions tunes a paraphrase beyond language and style.
+type ParaphraseOptions struct {
+	// TargetGrade is the desired Flesch–Kincaid grade level, if set
+	TargetGrade *float64
 }
 
 func NewOpenAIService(cfg *config.Config) *OpenAIService {
@@ -47,11 +69,56 @@ func NewOpenAIService(cfg *config.Config) *OpenAIService {
 		log.Fatal("OpenAI API key is not set")
 	}
 	return &OpenAIService{
-		apiKey: cfg.OpenAIKey,
+		apiKey:       cfg.OpenAIKey,
+		preservation: NewPreservationThresholds(cfg),
 	}
 }
 
 func (s *OpenAIService) Paraphrase(text, language, style string) (*ParaphraseResponse, error) {
+	return s.ParaphraseWithOptions(text, language, style, ParaphraseOptions{})
+}
+
+// ParaphraseWithOptions paraphrases text and checks that the result kept the
+// meaning of the original. Reformatted quotes, numbers, dates, links and
+// emails are restored first; results that still fail the check are
+// regenerated. If every attempt fails, the one with the fewest warnings is
+// returned along with its warnings.
+func (s *OpenAIService) ParaphraseWithOptions(text, language, style string, opts ParaphraseOptions) (*ParaphraseResponse, error) {
+	var best *ParaphraseResponse
+	var bestReport *PreservationReport
+	tokens := 0
+
+	for attempt := 1; attempt <= s.preservation.MaxRegenerations+1; attempt++ {
+		resp, err := s.paraphraseOnce(text, language, style, opts)
+		if err != nil {
+			if best != nil {
+				break
+			}
+			return nil, err
+		}
+		tokens += resp.TokensUsed
+
+		resp.Verification = VerifyProtectedSpans(text, resp.Paraphrased)
+		resp.Paraphrased = resp.Verification.Text
+
+		report := CheckPreservation(text, resp.Paraphrased, s.preservation)
+		if best == nil || len(report.Warnings) < len(bestReport.Warnings) {
+			best, bestReport = resp, report
+		}
+		best.Attempts = attempt
+
+		if !report.Violated {
+			break
+		}
+		log.Printf("Paraphrase attempt %d failed preservation check: %s", attempt, report.Summary())
+	}
+
+	best.QualityWarnings = bestReport.Warnings
+	best.TokensUsed = tokens
+	return best, nil
+}
+
+func (s *OpenAIService) paraphraseOnce(text, language, style string, opts ParaphraseOptions) (*ParaphraseResponse, error) {
 	// Add style-specific instructions
 	styleGuide := ""
 	switch style {
@@ -103,6 +170,14 @@ Additional style guide:
 - Focus on creating memorable and impactful expressions`
 	}
 
+	if opts.TargetGrade != nil {
+		if styleGuide == "" {
+			styleGuide = "\nAdditional style guide:"
+		}
+		styleGuide += fmt.Sprintf(`
+- Aim for a Flesch-Kincaid grade level of about %.0f, adjusting sentence length and word choice to match`, *opts.TargetGrade)
+	}
+
 	var prompt string
 	if language == "auto" {
 		prompt = fmt.Sprintf(`
@@ -179,22 +254,70 @@ Your task is to paraphrase the text enclosed within <<START TEXT>> and <<END TEX
 `, language, style, styleGuide, text)
 	}
 
+	content, tokens, err := s.complete(prompt, 1.0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response for auto-detect case
+	if language == "auto" {
+		detectedLanguage, paraphrasedText, err := splitDetectedLanguage(content)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ParaphraseResponse{
+			Paraphrased:      paraphrasedText,
+			DetectedLanguage: detectedLanguage,
+			TokensUsed:       tokens,
+		}, nil
+	}
+
+	// For non-auto cases, return the specified language
+	return &ParaphraseResponse{
+		Paraphrased:      content,
+		DetectedLanguage: language,
+		TokensUsed:       tokens,
+	}, nil
+}
+
+// splitDetectedLanguage separates the "DETECTED_LANGUAGE: ..." header that
+// auto-detect prompts ask for from the text that follows it.
+func splitDetectedLanguage(content string) (string, string, error) {
+	lines := strings.Split(content, "\n")
+	if len(lines) < 3 {
+		return "", "", fmt.Errorf("invalid response format")
+	}
+
+	// Extract detected language
+	langLine := lines[0]
+	langLine = strings.TrimPrefix(langLine, "DETECTED_LANGUAGE: ")
+	langLine = strings.TrimPrefix(langLine, "DETECTED LANGUAGE: ")
+	detectedLanguage := strings.TrimSpace(langLine)
+
+	// Get the text (everything after the second line)
+	return detectedLanguage, strings.Join(lines[2:], "\n"), nil
+}
+
+// complete sends prompt as a system message and returns the model's reply
+// and the number of tokens the call used.
+func (s *OpenAIService) complete(prompt string, temperature float64) (string, int, error) {
 	request := OpenAIRequest{
-		Model: "gpt-4",
+		Model: OpenAIModel,
 		Messages: []Message{
 			{Role: "system", Content: prompt},
 		},
-		Temperature: 1.0,
+		Temperature: temperature,
 	}
 
 	jsonData, err := json.Marshal(request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to prepare request: %v", err)
+		return "", 0, fmt.Errorf("failed to prepare request: %v", err)
 	}
 
 	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return "", 0, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -203,50 +326,24 @@ Your task is to paraphrase the text enclosed within <<START TEXT>> and <<END TEX
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %v", err)
+		return "", 0, fmt.Errorf("failed to make request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	var response OpenAIResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
+		return "", 0, fmt.Errorf("failed to parse response: %v", err)
 	}
 
 	if response.Error != nil {
-		return nil, fmt.Errorf("OpenAI API error: %s", response.Error.Message)
+		return "", 0, fmt.Errorf("OpenAI API error: %s", response.Error.Message)
 	}
 
 	if len(response.Choices) == 0 {
-		return nil, fmt.Errorf("no response from OpenAI")
+		return "", 0, fmt.Errorf("no response from OpenAI")
 	}
 
-	// Parse response for auto-detect case
-	if language == "auto" {
-		lines := strings.Split(response.Choices[0].Message.Content, "\n")
-		if len(lines) < 3 {
-			return nil, fmt.Errorf("invalid response format")
-		}
-
-		// Extract detected language
-		langLine := lines[0]
-		langLine = strings.TrimPrefix(langLine, "DETECTED_LANGUAGE: ")
-		langLine = strings.TrimPrefix(langLine, "DETECTED LANGUAGE: ")
-		detectedLanguage := strings.TrimSpace(langLine)
-
-		// Get paraphrased text (everything after the second line)
-		paraphrasedText := strings.Join(lines[2:], "\n")
-
-		return &ParaphraseResponse{
-			Paraphrased:      paraphrasedText,
-			DetectedLanguage: detectedLanguage,
-		}, nil
-	}
-
-	// For non-auto cases, return the specified language
-	return &ParaphraseResponse{
-		Paraphrased:      response.Choices[0].Message.Content,
-		DetectedLanguage: language,
-	}, nil
+	return response.Choices[0].Message.Content, response.Usage.TotalTokens, nil
 }
 
 func (s *OpenAIService) ParaphraseText(text string) (string, error) {
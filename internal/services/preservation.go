@@ -0,0 +1,200 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/arrinal/paraphrase-saas/internal/config"
+)
+
+// Below this many words the length and sentence ratios are too noisy to act on
+const minWordsForRatioChecks = 20
+
+// PreservationThresholds decide when a paraphrase has drifted too far from
+// the original and should be regenerated.
+type PreservationThresholds struct {
+	MaxRegenerations int
+	MinLengthRatio   float64
+	MaxLengthRatio   float64
+	MinSentenceRatio float64
+	MinNumberRecall  float64
+	MinEntityRecall  float64
+	RequireQuotes    bool
+}
+
+func NewPreservationThresholds(cfg *config.Config) PreservationThresholds {
+	return PreservationThresholds{
+		MaxRegenerations: cfg.PreservationMaxRegenerations,
+		MinLengthRatio:   cfg.PreservationMinLengthRatio,
+		MaxLengthRatio:   cfg.PreservationMaxLengthRatio,
+		MinSentenceRatio: cfg.PreservationMinSentenceRatio,
+		MinNumberRecall:  cfg.PreservationMinNumberRecall,
+		MinEntityRecall:  cfg.PreservationMinEntityRecall,
+		RequireQuotes:    cfg.PreservationRequireQuotes,
+	}
+}
+
+// PreservationReport is the outcome of comparing a paraphrase to its source.
+type PreservationReport struct {
+	LengthRatio     float64
+	SentenceRatio   float64
+	NumberRecall    float64
+	EntityRecall    float64
+	MissingNumbers  []string
+	MissingEntities []string
+	MissingQuotes   []string
+	MissingOther    []string
+	Warnings        []string
+	Violated        bool
+}
+
+// CheckPreservation compares original and paraphrased text. Every failed
+// check adds a warning; Violated is set when a threshold is crossed.
+func CheckPreservation(original, paraphrased string, t PreservationThresholds) *PreservationReport {
+	report := &PreservationReport{}
+	warn := func(format string, args ...interface{}) {
+		report.Warnings = append(report.Warnings, fmt.Sprintf(format, args...))
+		report.Violated = true
+	}
+
+	origWords := len(wordPattern.FindAllString(original, -1))
+	outWords := len(wordPattern.FindAllString(paraphrased, -1))
+	if origWords > 0 {
+		report.LengthRatio = round2(float64(outWords) / float64(origWords))
+		report.SentenceRatio = round2(float64(countSentences(paraphrased)) / float64(countSentences(original)))
+	}
+
+	if origWords >= minWordsForRatioChecks {
+		if report.LengthRatio < t.MinLengthRatio {
+			warn("output is much shorter than the original (%.0f%% of its length)", report.LengthRatio*100)
+		} else if report.LengthRatio > t.MaxLengthRatio {
+			warn("output is much longer than the original (%.0f%% of its length)", report.LengthRatio*100)
+		}
+		if report.SentenceRatio < t.MinSentenceRatio {
+			warn("output has far fewer sentences than the original, parts may have been omitted")
+		}
+	}
+
+	// Numbers, quotes, dates, links and emails must survive verbatim
+	spans := make(map[string][]string)
+	for _, span := range ExtractProtectedSpans(original) {
+		spans[span.Kind] = append(spans[span.Kind], span.Text)
+	}
+	spanRecall := func(kind string) (float64, []string) {
+		return recall(spans[kind], func(text string) bool {
+			return containsSpan(paraphrased, ProtectedSpan{Kind: kind, Text: text})
+		})
+	}
+
+	report.NumberRecall, report.MissingNumbers = spanRecall(SpanKindNumber)
+	if report.NumberRecall < t.MinNumberRecall {
+		warn("numbers missing from output: %s", strings.Join(report.MissingNumbers, ", "))
+	}
+
+	_, report.MissingQuotes = spanRecall(SpanKindQuote)
+	if t.RequireQuotes && len(report.MissingQuotes) > 0 {
+		warn("quotes not kept verbatim: %s", strings.Join(report.MissingQuotes, ", "))
+	}
+
+	for _, kind := range []string{SpanKindDate, SpanKindURL, SpanKindEmail} {
+		_, missing := spanRecall(kind)
+		report.MissingOther = append(report.MissingOther, missing...)
+	}
+	if len(report.MissingOther) > 0 {
+		warn("dates, links or email addresses changed or missing: %s", strings.Join(report.MissingOther, ", "))
+	}
+
+	report.EntityRecall, report.MissingEntities = recall(extractNamedEntities(original), func(name string) bool {
+		return strings.Contains(paraphrased, name)
+	})
+	if report.EntityRecall < t.MinEntityRecall {
+		warn("names missing from output: %s", strings.Join(report.MissingEntities, ", "))
+	}
+
+	return report
+}
+
+// Summary describes the report by counts only. Warnings quote the user's
+// text, so they must not be logged.
+func (r *PreservationReport) Summary() string {
+	parts := []string{
+		fmt.Sprintf("%d warnings", len(r.Warnings)),
+		fmt.Sprintf("length ratio %.2f", r.LengthRatio),
+		fmt.Sprintf("sentence ratio %.2f", r.SentenceRatio),
+	}
+	for _, missing := range []struct {
+		kind  string
+		items []string
+	}{
+		{"numbers", r.MissingNumbers},
+		{"quotes", r.MissingQuotes},
+		{"names", r.MissingEntities},
+		{"dates, links or emails", r.MissingOther},
+	} {
+		if len(missing.items) > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s missing", len(missing.items), missing.kind))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// recall returns the share of distinct items that contains reports as
+// present, and the distinct items that are not.
+func recall(items []string, contains func(item string) bool) (float64, []string) {
+	seen := make(map[string]bool)
+	var missing []string
+	found := 0
+	for _, item := range items {
+		if seen[item] {
+			continue
+		}
+		seen[item] = true
+		if contains(item) {
+			found++
+		} else {
+			missing = append(missing, item)
+		}
+	}
+	if len(seen) == 0 {
+		return 1, nil
+	}
+	return round2(float64(found) / float64(len(seen))), missing
+}
+
+// extractNamedEntities approximates proper nouns as capitalised words that
+// do not start a sentence, joining consecutive ones ("New York Times").
+func extractNamedEntities(text string) []string {
+	var entities []string
+	var current []string
+	sentenceStart := true
+
+	flush := func() {
+		if len(current) > 0 {
+			entities = append(entities, strings.Join(current, " "))
+			current = nil
+		}
+	}
+
+	for _, loc := range wordPattern.FindAllStringIndex(text, -1) {
+		word := text[loc[0]:loc[1]]
+		first := []rune(word)[0]
+
+		if unicode.IsUpper(first) && !sentenceStart {
+			current = append(current, word)
+		} else {
+			flush()
+		}
+
+		// Look at what follows the word to see if a new sentence begins
+		next, _ := utf8.DecodeRuneInString(strings.TrimLeft(text[loc[1]:], `"'”’)]`))
+		sentenceStart = strings.ContainsRune(".!?…\n", next)
+		if !unicode.IsSpace(next) {
+			flush()
+		}
+	}
+	flush()
+
+	return entities
+}
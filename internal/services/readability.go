@@ -0,0 +1,147 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/arrinal/paraphrase-saas/internal/models"
+)
+
+var (
+	wordPattern     = regexp.MustCompile(`[\p{L}\p{N}]+(?:['’][\p{L}]+)*`)
+	sentenceEnd     = regexp.MustCompile(`[.!?…]+["'”’)\]]*(?:\s+|$)|\n\s*\n`)
+	vowelGroup      = regexp.MustCompile(`[aeiouy]+`)
+	latinWordSuffix = regexp.MustCompile(`[^aeiouy]e$`)
+)
+
+// styleGradeRanges are the Flesch–Kincaid grades we expect a style to land
+// in. Zero means no bound.
+var styleGradeRanges = map[string]struct{ min, max float64 }{
+	"academic": {min: 10},
+	"casual":   {max: 8},
+}
+
+// AnalyzeReadability computes readability statistics for text. The Flesch
+// formulas and syllable counting are calibrated for English; other
+// languages still get comparable, if less meaningful, numbers.
+func AnalyzeReadability(text string) models.TextReadability {
+	words := wordPattern.FindAllString(text, -1)
+	if len(words) == 0 {
+		return models.TextReadability{}
+	}
+
+	sentences := countSentences(text)
+	syllables := 0
+	unique := make(map[string]bool)
+	for _, word := range words {
+		lower := strings.ToLower(word)
+		unique[lower] = true
+		syllables += countSyllables(lower)
+	}
+
+	wordsPerSentence := float64(len(words)) / float64(sentences)
+	syllablesPerWord := float64(syllables) / float64(len(words))
+
+	return models.TextReadability{
+		Words:              len(words),
+		Sentences:          sentences,
+		Syllables:          syllables,
+		FleschReadingEase:  round2(206.835 - 1.015*wordsPerSentence - 84.6*syllablesPerWord),
+		FleschKincaidGrade: round2(0.39*wordsPerSentence + 11.8*syllablesPerWord - 15.59),
+		AvgSentenceLength:  round2(wordsPerSentence),
+		LexicalDiversity:   round2(float64(len(unique)) / float64(len(words))),
+	}
+}
+
+// ComputeQualityMetrics compares original and paraphrased text and checks
+// the paraphrase against the style's expected grade range and, if set, the
+// requested target grade.
+func ComputeQualityMetrics(original, paraphrased, style string, targetGrade *float64) *models.QualityMetrics {
+	metrics := &models.QualityMetrics{
+		Original:    AnalyzeReadability(original),
+		Paraphrased: AnalyzeReadability(paraphrased),
+		Similarity:  round2(TextSimilarity(original, paraphrased)),
+		TargetGrade: targetGrade,
+	}
+	grade := metrics.Paraphrased.FleschKincaidGrade
+
+	if r, ok := styleGradeRanges[style]; ok && metrics.Paraphrased.Words > 0 {
+		met := (r.min == 0 || grade >= r.min) && (r.max == 0 || grade <= r.max)
+		metrics.StyleExpectationMet = &met
+		if !met {
+			metrics.Notes = append(metrics.Notes, fmt.Sprintf("%s output reads at grade %.1f, outside the expected range for this style", style, grade))
+		}
+	}
+
+	if targetGrade != nil && math.Abs(grade-*targetGrade) > 2 {
+		metrics.Notes = append(metrics.Notes, fmt.Sprintf("output reads at grade %.1f, target was %.1f", grade, *targetGrade))
+	}
+
+	return metrics
+}
+
+// TextSimilarity returns the cosine similarity of the word frequencies of a
+// and b, from 0 (no shared words) to 1 (same words in the same proportions).
+func TextSimilarity(a, b string) float64 {
+	freqA := wordFrequencies(a)
+	freqB := wordFrequencies(b)
+	if len(freqA) == 0 || len(freqB) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for word, countA := range freqA {
+		dot += countA * freqB[word]
+		normA += countA * countA
+	}
+	for _, countB := range freqB {
+		normB += countB * countB
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func wordFrequencies(text string) map[string]float64 {
+	freq := make(map[string]float64)
+	for _, word := range wordPattern.FindAllString(text, -1) {
+		freq[strings.ToLower(word)]++
+	}
+	return freq
+}
+
+func countSentences(text string) int {
+	count := 0
+	last := 0
+	for _, loc := range sentenceEnd.FindAllStringIndex(text, -1) {
+		if wordPattern.MatchString(text[last:loc[1]]) {
+			count++
+		}
+		last = loc[1]
+	}
+	// Trailing text without final punctuation is still a sentence
+	if wordPattern.MatchString(text[last:]) {
+		count++
+	}
+	if count == 0 {
+		count = 1
+	}
+	return count
+}
+
+// countSyllables estimates English syllables by counting vowel groups.
+func countSyllables(word string) int {
+	count := len(vowelGroup.FindAllString(word, -1))
+	if count > 1 && latinWordSuffix.MatchString(word) && !strings.HasSuffix(word, "le") {
+		count-- // silent trailing "e"
+	}
+	if count == 0 {
+		count = 1
+	}
+	return count
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
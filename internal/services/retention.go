@@ -0,0 +1,73 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+)
+
+const retentionPurgeInterval = time.Hour
+
+// Finished job results of users who store nothing are kept this long so
+// they can still be downloaded.
+const noRetentionJobResultTTL = time.Hour
+
+// StartRetentionPurge enforces every user's history retention setting, once
+// at startup and then every hour.
+func StartRetentionPurge() {
+	go func() {
+		for {
+			if err := EnforceRetention(nil); err != nil {
+				log.Printf("Error enforcing history retention: %v", err)
+			}
+			time.Sleep(retentionPurgeInterval)
+		}
+	}()
+}
+
+// EnforceRetention removes the text of history entries, including trashed
+// ones, that are older than their owner's retention setting allows, along
+// with stored job results. The entries themselves are kept as metadata so
+// usage stats stay intact. If userID is set only that user is processed.
+func EnforceRetention(userID *uint) error {
+	// scope returns query and its arguments, limited to userID if it is set
+	scope := func(query string, args ...interface{}) (string, []interface{}) {
+		if userID == nil {
+			return query, args
+		}
+		return query + " AND u.id = ?", append(args, *userID)
+	}
+
+	query, args := scope(`UPDATE paraphrase_histories AS h
+		SET original_text = '', paraphrased_text = '', edits = NULL, redacted = true, encrypted = false
+		FROM users AS u
+		WHERE u.id = h.user_id AND NOT h.redacted
+		AND (u.history_retention = ?
+			OR (u.history_retention = ? AND h.created_at < NOW() - make_interval(days => u.history_retention_days)))`,
+		models.RetentionNone, models.RetentionDays)
+	result := db.DB.Exec(query, args...)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Removed text from %d history entries past retention", result.RowsAffected)
+	}
+
+	// Result files live outside the database, so they are removed one by one
+	query, args = scope(`SELECT j.id, j.result_path FROM jobs AS j
+		JOIN users AS u ON u.id = j.user_id
+		WHERE j.result_path <> '' AND j.completed_at IS NOT NULL
+		AND ((u.history_retention = ? AND j.completed_at < ?)
+			OR (u.history_retention = ? AND j.completed_at < NOW() - make_interval(days => u.history_retention_days)))`,
+		models.RetentionNone, time.Now().Add(-noRetentionJobResultTTL), models.RetentionDays)
+	var jobs []models.Job
+	if err := db.DB.Raw(query, args...).Scan(&jobs).Error; err != nil {
+		return err
+	}
+	for i := range jobs {
+		RemoveJobResult(&jobs[i])
+	}
+	return nil
+}
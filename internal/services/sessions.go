@@ -0,0 +1,173 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"gorm.io/gorm"
+)
+
+// Session lookups are cached this long, so a session revoked on another
+// server stops working within this time. Revocations on this server take
+// effect at once.
+const sessionCacheTTL = 30 * time.Second
+
+// Past this size expired entries are swept from the cache
+const sessionCacheSweepSize = 10000
+
+type cachedSession struct {
+	session   *models.Session // nil if revoked or unknown
+	fetchedAt time.Time
+}
+
+var sessionCache = struct {
+	sync.Mutex
+	entries map[string]cachedSession
+}{entries: make(map[string]cachedSession)}
+
+// ActiveSession returns the live session with the given token ID, or nil
+// if it has been revoked or has expired. The session's last-seen time and
+// IP are refreshed whenever it is loaded from the database.
+func ActiveSession(tokenID, ip string) (*models.Session, error) {
+	now := time.Now()
+
+	sessionCache.Lock()
+	entry, ok := sessionCache.entries[tokenID]
+	sessionCache.Unlock()
+	if ok && now.Sub(entry.fetchedAt) < sessionCacheTTL {
+		return entry.session, nil
+	}
+
+	var session *models.Session
+	var found models.Session
+	err := db.DB.Where("token_id = ? AND revoked_at IS NULL AND expires_at > ?", tokenID, now).First(&found).Error
+	switch err {
+	case nil:
+		session = &found
+		if err := db.DB.Model(&found).UpdateColumns(map[string]interface{}{
+			"last_seen_at": now,
+			"ip":           ip,
+		}).Error; err != nil {
+			return nil, err
+		}
+	case gorm.ErrRecordNotFound:
+	default:
+		return nil, err
+	}
+
+	sessionCache.Lock()
+	if len(sessionCache.entries) >= sessionCacheSweepSize {
+		for id, e := range sessionCache.entries {
+			if now.Sub(e.fetchedAt) >= sessionCacheTTL {
+				delete(sessionCache.entries, id)
+			}
+		}
+	}
+	sessionCache.entries[tokenID] = cachedSession{session: session, fetchedAt: now}
+	sessionCache.Unlock()
+
+	return session, nil
+}
+
+// RevokeSession ends one of the user's sessions, reporting false if it
+// does not exist or has already ended.
+func RevokeSession(userID, sessionID uint) (bool, error) {
+	revoked, err := revokeSessions(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("user_id = ? AND id = ?", userID, sessionID)
+	})
+	return revoked > 0, err
+}
+
+// RevokeUserSessions ends all of the user's sessions except keep, which
+// may be zero to end them all.
+func RevokeUserSessions(userID, keep uint) (int, error) {
+	return revokeSessions(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("user_id = ? AND id <> ?", userID, keep)
+	})
+}
+
+// revokeSessions revokes the active sessions matched by scope along with
+// their refresh tokens, and drops them from this server's cache.
+func revokeSessions(scope func(tx *gorm.DB) *gorm.DB) (int, error) {
+	var sessions []models.Session
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := scope(tx).Where("revoked_at IS NULL").Find(&sessions).Error; err != nil {
+			return err
+		}
+		if len(sessions) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(sessions))
+		for i, s := range sessions {
+			ids[i] = s.ID
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.Session{}).Where("id IN ?", ids).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("session_id IN ? AND revoked_at IS NULL", ids).
+			Update("revoked_at", now).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sessionCache.Lock()
+	for _, s := range sessions {
+		delete(sessionCache.entries, s.TokenID)
+	}
+	sessionCache.Unlock()
+
+	return len(sessions), nil
+}
+
+// DeviceName gives a short description of the client, such as
+// "Chrome on macOS", from its user agent.
+func DeviceName(userAgent string) string {
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"CFNetwork/", "iOS app"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	os := ""
+	for _, o := range []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Darwin", "iOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, o.token) {
+			os = o.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+	return "Unknown device"
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"gorm.io/gorm"
+)
+
+// Share link passwords are throttled like logins: wrong guesses slow down
+// the next one, and too many lock the link's password for a while. An IP
+// guessing at many links is blocked as well.
+const (
+	shareFailureWindow    = time.Hour
+	shareLockoutThreshold = 10
+	shareLockoutDuration  = 15 * time.Minute
+	shareIPThreshold      = 20
+	shareIPWindow         = 15 * time.Minute
+)
+
+// Advisory lock namespaces, continuing the login ones
+const (
+	shareLockLink = 3
+	shareLockIP   = 4
+)
+
+// CheckSharePassword runs verify, which compares the password given for
+// link, unless the link or ip has failed too often recently, in which case
+// it returns how long to wait instead. Wrong passwords are recorded before
+// it returns; guesses at the same link or from the same IP take turns.
+func CheckSharePassword(link *models.ShareLink, ip string, verify func() bool) (ok bool, retryAfter time.Duration, err error) {
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?::int, ?::int)", shareLockLink, link.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?::int, hashtext(?))", shareLockIP, ip).Error; err != nil {
+			return err
+		}
+
+		var err error
+		if retryAfter, err = checkShareThrottle(tx, link.ID, ip); err != nil || retryAfter > 0 {
+			return err
+		}
+
+		if ok = verify(); ok {
+			return nil
+		}
+
+		if err := tx.Create(&models.SharePasswordAttempt{ShareLinkID: link.ID, IP: ip}).Error; err != nil {
+			return err
+		}
+
+		count, _, err := shareFailures(tx, link.ID)
+		if err != nil {
+			return err
+		}
+		// Attempts wait out a lock, so every failure past the threshold
+		// starts a new one
+		if count >= shareLockoutThreshold {
+			RecordAuditEvent(models.AuditShareLockout, &link.UserID, ip,
+				fmt.Sprintf("share link %d locked after %d wrong passwords", link.ID, count))
+		}
+		return nil
+	})
+	return ok, retryAfter, err
+}
+
+func checkShareThrottle(tx *gorm.DB, linkID uint, ip string) (time.Duration, error) {
+	now := time.Now()
+
+	// Blocked until enough of the IP's recent failures age out of the window
+	var oldest []time.Time
+	if err := tx.Model(&models.SharePasswordAttempt{}).
+		Where("ip = ? AND created_at > ?", ip, now.Add(-shareIPWindow)).
+		Order("created_at DESC").
+		Offset(shareIPThreshold-1).
+		Limit(1).
+		Pluck("created_at", &oldest).Error; err != nil {
+		return 0, err
+	}
+	if len(oldest) > 0 {
+		return oldest[0].Add(shareIPWindow).Sub(now), nil
+	}
+
+	count, last, err := shareFailures(tx, linkID)
+	if err != nil || last == nil {
+		return 0, err
+	}
+
+	wait := *last
+	switch {
+	case count >= shareLockoutThreshold:
+		wait = last.Add(shareLockoutDuration)
+	case count >= loginFreeFailures:
+		wait = last.Add(loginDelay(count))
+	}
+	if wait.After(now) {
+		return wait.Sub(now), nil
+	}
+	return 0, nil
+}
+
+// shareFailures counts the wrong passwords given for a link within the
+// failure window, and returns the time of the latest.
+func shareFailures(tx *gorm.DB, linkID uint) (int, *time.Time, error) {
+	var result struct {
+		Count int
+		Last  *time.Time
+	}
+	err := tx.Model(&models.SharePasswordAttempt{}).
+		Select("COUNT(*) AS count, MAX(created_at) AS last").
+		Where("share_link_id = ? AND created_at > ?", linkID, time.Now().Add(-shareFailureWindow)).
+		Scan(&result).Error
+	return result.Count, result.Last, err
+}
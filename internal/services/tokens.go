@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/auth"
+	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	RefreshTokenTTL    = 7 * 24 * time.Hour
+	tokenPurgeInterval = time.Hour
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+)
+
+// TokenPair is an access token with the refresh token that renews it.
+type TokenPair struct {
+	Token        string
+	RefreshToken string
+}
+
+// StartSession records a new login from the given client and issues its
+// first token pair.
+func StartSession(cfg *config.Config, userID uint, ip, userAgent string) (*TokenPair, error) {
+	tokenID, err := auth.RandomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	var pair *TokenPair
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		session := models.Session{
+			UserID:     userID,
+			TokenID:    tokenID,
+			Device:     DeviceName(userAgent),
+			IP:         ip,
+			UserAgent:  userAgent,
+			LastSeenAt: now,
+			ExpiresAt:  now.Add(RefreshTokenTTL),
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		pair, err = issueTokens(tx, cfg, &session)
+		return err
+	})
+	return pair, err
+}
+
+func issueTokens(tx *gorm.DB, cfg *config.Config, session *models.Session) (*TokenPair, error) {
+	token, err := auth.GenerateToken(session.UserID, session.TokenID, cfg.JWTSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := auth.RandomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Create(&models.RefreshToken{
+		UserID:    session.UserID,
+		SessionID: session.ID,
+		TokenHash: auth.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{Token: token, RefreshToken: refreshToken}, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new pair and extends its
+// session. Each refresh token works once; presenting one again means it
+// was copied, so its session is revoked and ErrRefreshTokenReused
+// returned.
+func RefreshTokens(cfg *config.Config, refreshToken string) (*TokenPair, error) {
+	var pair *TokenPair
+	var reusedSession uint
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var stored models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", auth.HashToken(refreshToken)).
+			First(&stored).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		if stored.RevokedAt != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		now := time.Now()
+		if stored.UsedAt != nil {
+			reusedSession = stored.SessionID
+			return nil
+		}
+
+		if stored.ExpiresAt.Before(now) {
+			return ErrInvalidRefreshToken
+		}
+
+		var session models.Session
+		if err := tx.Where("id = ? AND revoked_at IS NULL", stored.SessionID).First(&session).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		if err := tx.Model(&stored).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&session).Updates(map[string]interface{}{
+			"last_seen_at": now,
+			"expires_at":   now.Add(RefreshTokenTTL),
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		pair, err = issueTokens(tx, cfg, &session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reusedSession != 0 {
+		if _, err := revokeSessions(func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("id = ?", reusedSession)
+		}); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	return pair, nil
+}
+
+// StartTokenPurge deletes expired refresh tokens, sessions, account tokens
+// and unfinished provider sign-ins every hour.
+// Used tokens are kept until then so reuse can still be detected.
+func StartTokenPurge() {
+	go func() {
+		for {
+			now := time.Now()
+			if err := db.DB.Where("expires_at < ?", now).Delete(&models.RefreshToken{}).Error; err != nil {
+				log.Printf("Error purging expired refresh tokens: %v", err)
+			}
+			if err := db.DB.Where("expires_at < ?", now).Delete(&models.Session{}).Error; err != nil {
+				log.Printf("Error purging expired sessions: %v", err)
+			}
+			if err := db.DB.Where("expires_at < ?", now).Delete(&models.AccountToken{}).Error; err != nil {
+				log.Printf("Error purging expired account tokens: %v", err)
+			}
+			if err := db.DB.Where("expires_at < ?", now).Delete(&models.OIDCLoginState{}).Error; err != nil {
+				log.Printf("Error purging expired sign-in states: %v", err)
+			}
+			if err := db.DB.Where("created_at < ?", now.Add(-loginFailureWindow)).Delete(&models.LoginAttempt{}).Error; err != nil {
+				log.Printf("Error purging old login attempts: %v", err)
+			}
+			if err := db.DB.Where("created_at < ?", now.Add(-shareFailureWindow)).Delete(&models.SharePasswordAttempt{}).Error; err != nil {
+				log.Printf("Error purging old share password attempts: %v", err)
+			}
+			time.Sleep(tokenPurgeInterval)
+		}
+	}()
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/config"
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+	"gorm.io/gorm"
+)
+
+const trashPurgeInterval = time.Hour
+
+// TrashCutoff is the deletion time before which history can no longer be
+// restored.
+func TrashCutoff(cfg *config.Config) time.Time {
+	return time.Now().AddDate(0, 0, -cfg.HistoryTrashRetentionDays)
+}
+
+// StartTrashPurge hard-deletes history that has been in the trash longer
+// than the retention window, once at startup and then every hour.
+func StartTrashPurge(cfg *config.Config) {
+	go func() {
+		for {
+			PurgeTrash(cfg)
+			time.Sleep(trashPurgeInterval)
+		}
+	}()
+}
+
+// PurgeTrash permanently removes expired trashed history along with its
+// tags, folder memberships, ratings and share links, and detaches the jobs
+// that produced it. Usage records are kept so quotas are unaffected.
+func PurgeTrash(cfg *config.Config) {
+	// One cutoff for every statement, so an entry that expires while the
+	// purge runs cannot be deleted without its dependents
+	cutoff := TrashCutoff(cfg)
+	var purged int64
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Unscoped().Model(&models.ParaphraseHistory{}).
+			Select("id").
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff)
+
+		if err := tx.Where("history_id IN (?)", expired).Delete(&models.HistoryTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("history_id IN (?)", expired).Delete(&models.FolderItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("history_id IN (?)", expired).Delete(&models.Rating{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("history_id IN (?)", expired).Delete(&models.ShareLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Job{}).Where("history_id IN (?)", expired).Update("history_id", nil).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Delete(&models.ParaphraseHistory{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		log.Printf("Error purging trashed history: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("Purged %d trashed history entries", purged)
+	}
+}
@@ -0,0 +1,19 @@
+package services
+
+import (
+	"time"
+
+	"github.com/arrinal/paraphrase-saas/internal/db"
+	"github.com/arrinal/paraphrase-saas/internal/models"
+)
+
+// RequestsToday returns how many model requests the user has made since
+// midnight UTC, by the usage ledger.
+func RequestsToday(userID uint) (int, error) {
+	var requests int
+	err := db.DB.Model(&models.UsageRecord{}).
+		Select("COALESCE(SUM(requests), 0)").
+		Where("user_id = ? AND created_at >= ?", userID, time.Now().UTC().Truncate(24*time.Hour)).
+		Scan(&requests).Error
+	return requests, err
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	SpanKindURL    = "url"
+	SpanKindEmail  = "email"
+	SpanKindQuote  = "quote"
+	SpanKindDate   = "date"
+	SpanKindNumber = "number"
+)
+
+// A quote rewritten at least this much alike is treated as a damaged copy
+// of the original and restored, rather than flagged.
+const quoteRepairSimilarity = 0.6
+
+const monthName = `(?:Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|June?|July?|Aug(?:ust)?|Sep(?:t(?:ember)?)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)`
+
+// spanPatterns are tried in order; a later kind never matches inside an
+// earlier one, so the number in a date or URL is not checked twice.
+var spanPatterns = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{SpanKindURL, regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"'“”]+[^\s<>"'“”.,;:!?)\]]`)},
+	{SpanKindEmail, regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+	{SpanKindQuote, regexp.MustCompile(`"[^"\n]+"|“[^”\n]+”`)},
+	{SpanKindDate, regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}\b|\b\d{1,2}[/.]\d{1,2}[/.]\d{2,4}\b|(?i)\b` + monthName + `\.? \d{1,2}(?:st|nd|rd|th)?,? \d{4}\b|(?i)\b\d{1,2}(?:st|nd|rd|th)? ` + monthName + `\.?,? \d{4}\b`)},
+	{SpanKindNumber, regexp.MustCompile(`\d+(?:[.,]\d+)*%?`)},
+}
+
+var dateLayouts = []string{
+	"2006-01-02", "1/2/2006", "01/02/2006", "2.1.2006", "02.01.2006", "1/2/06",
+	"January 2 2006", "Jan 2 2006", "2 January 2006", "2 Jan 2006",
+}
+
+// ProtectedSpan is a piece of the original text that must appear verbatim
+// in the paraphrase.
+type ProtectedSpan struct {
+	Kind   string `json:"kind"`
+	Text   string `json:"text"`
+	Offset int    `json:"offset"`
+}
+
+// VerificationResult reports which protected spans survived paraphrasing.
+// Text is the paraphrase with any repairs applied.
+type VerificationResult struct {
+	Text     string          `json:"-"`
+	Checked  int             `json:"checked"`
+	Repaired []ProtectedSpan `json:"repaired,omitempty"`
+	Missing  []ProtectedSpan `json:"missing,omitempty"`
+	Flagged  bool            `json:"flagged"`
+}
+
+// ExtractProtectedSpans finds quotes, numbers, dates, URLs and email
+// addresses in text, ordered by offset.
+func ExtractProtectedSpans(text string) []ProtectedSpan {
+	var spans []ProtectedSpan
+	var covered [][]int
+
+	overlaps := func(loc []int) bool {
+		for _, c := range covered {
+			if loc[0] < c[1] && c[0] < loc[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, p := range spanPatterns {
+		for _, loc := range p.pattern.FindAllStringIndex(text, -1) {
+			if overlaps(loc) {
+				continue
+			}
+			covered = append(covered, loc)
+			spans = append(spans, ProtectedSpan{Kind: p.kind, Text: text[loc[0]:loc[1]], Offset: loc[0]})
+		}
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Offset < spans[j].Offset })
+	return spans
+}
+
+// VerifyProtectedSpans checks that every protected span of original appears
+// verbatim in paraphrased. A span that was only reformatted (a number
+// regrouped, a date rewritten, a quote lightly reworded) is restored in
+// place; anything else is reported as missing and the result is flagged.
+func VerifyProtectedSpans(original, paraphrased string) *VerificationResult {
+	result := &VerificationResult{Text: paraphrased}
+	seen := make(map[string]bool)
+
+	for _, span := range ExtractProtectedSpans(original) {
+		if seen[span.Kind+span.Text] {
+			continue
+		}
+		seen[span.Kind+span.Text] = true
+		result.Checked++
+
+		if containsSpan(result.Text, span) {
+			continue
+		}
+
+		if repaired, ok := repairSpan(result.Text, original, span); ok {
+			result.Text = repaired
+			result.Repaired = append(result.Repaired, span)
+			continue
+		}
+
+		result.Missing = append(result.Missing, span)
+	}
+
+	result.Flagged = len(result.Missing) > 0
+	return result
+}
+
+// containsSpan reports whether span appears in text. Numbers must stand on
+// their own, so "3" is not found inside "2023".
+func containsSpan(text string, span ProtectedSpan) bool {
+	if span.Kind != SpanKindNumber {
+		return strings.Contains(text, span.Text)
+	}
+
+	for start := 0; ; {
+		i := strings.Index(text[start:], span.Text)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(span.Text)
+		if !digitBefore(text, i) && !digitAfter(text, end) {
+			return true
+		}
+		start = i + 1
+	}
+}
+
+func digitBefore(text string, i int) bool {
+	r, _ := utf8.DecodeLastRuneInString(text[:i])
+	return unicode.IsDigit(r)
+}
+
+func digitAfter(text string, i int) bool {
+	rest := text[i:]
+	// "12" followed by ".5" is part of "12.5"
+	if strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, ",") {
+		rest = rest[1:]
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return unicode.IsDigit(r)
+}
+
+// repairSpan looks for a reformatted copy of span in text and replaces it
+// with the original wording. Candidates that are themselves verbatim spans
+// of the original are left alone.
+func repairSpan(text, original string, span ProtectedSpan) (string, bool) {
+	var best *ProtectedSpan
+	bestScore := 0.0
+
+	for _, candidate := range ExtractProtectedSpans(text) {
+		if candidate.Kind != span.Kind || strings.Contains(original, candidate.Text) {
+			continue
+		}
+
+		score := spanEquivalence(span, candidate)
+		if score > bestScore {
+			c := candidate
+			best, bestScore = &c, score
+		}
+	}
+
+	if best == nil {
+		return text, false
+	}
+	return text[:best.Offset] + span.Text + text[best.Offset+len(best.Text):], true
+}
+
+// spanEquivalence scores how likely candidate is a rewritten form of span,
+// from 0 (unrelated) to 1 (same value, different formatting).
+func spanEquivalence(span, candidate ProtectedSpan) float64 {
+	switch span.Kind {
+	case SpanKindNumber:
+		a, okA := normalizeNumber(span.Text)
+		b, okB := normalizeNumber(candidate.Text)
+		if okA && okB && a == b {
+			return 1
+		}
+	case SpanKindDate:
+		a, okA := parseDateSpan(span.Text)
+		b, okB := parseDateSpan(candidate.Text)
+		if okA && okB && a.Equal(b) {
+			return 1
+		}
+	case SpanKindURL:
+		if strings.EqualFold(strings.TrimSuffix(span.Text, "/"), strings.TrimSuffix(candidate.Text, "/")) {
+			return 1
+		}
+	case SpanKindEmail:
+		if strings.EqualFold(span.Text, candidate.Text) {
+			return 1
+		}
+	case SpanKindQuote:
+		if sim := TextSimilarity(span.Text, candidate.Text); sim >= quoteRepairSimilarity {
+			return sim
+		}
+	}
+	return 0
+}
+
+// normalizeNumber rewrites a number span as plain digits with a "." decimal
+// point, so "1,250.5" and "1.250,5" compare equal but "12.5" and "125" do
+// not. It fails when the separators don't say which one is the decimal
+// point, as in "1,250" or "1.250".
+func normalizeNumber(s string) (string, bool) {
+	percent := strings.HasSuffix(s, "%")
+	s = strings.TrimSuffix(s, "%")
+
+	decimal := -1
+	lastDot, lastComma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		// With both, the last one is the decimal point and must be the only one
+		decimal = max(lastDot, lastComma)
+		if strings.Count(s, s[decimal:decimal+1]) > 1 {
+			return "", false
+		}
+	case lastDot >= 0 || lastComma >= 0:
+		sep := max(lastDot, lastComma)
+		if strings.Count(s, s[sep:sep+1]) == 1 {
+			// A lone separator before three digits could be either
+			if len(s)-sep-1 == 3 {
+				return "", false
+			}
+			decimal = sep
+		}
+	}
+
+	whole, fraction := s, ""
+	if decimal >= 0 {
+		whole, fraction = s[:decimal], s[decimal+1:]
+	}
+
+	// Thousands separators must group the digits in threes
+	groups := strings.FieldsFunc(whole, func(r rune) bool { return r == '.' || r == ',' })
+	for _, group := range groups[1:] {
+		if len(group) != 3 {
+			return "", false
+		}
+	}
+
+	whole = strings.TrimLeft(strings.Join(groups, ""), "0")
+	if whole == "" {
+		whole = "0"
+	}
+	if fraction = strings.TrimRight(fraction, "0"); fraction != "" {
+		whole += "." + fraction
+	}
+	if percent {
+		whole += "%"
+	}
+	return whole, true
+}
+
+var ordinalSuffix = regexp.MustCompile(`(\d)(?:st|nd|rd|th)\b`)
+
+func parseDateSpan(s string) (time.Time, bool) {
+	s = ordinalSuffix.ReplaceAllString(s, "$1")
+	s = strings.NewReplacer(",", "", ".", " ").Replace(s)
+	s = strings.Join(strings.Fields(s), " ")
+
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+		// Dotted numeric dates lost their dots above
+		if t, err := time.Parse(strings.ReplaceAll(layout, ".", " "), s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}